@@ -1,13 +1,18 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"juniortest/internal/config"
+	"juniortest/internal/directory"
 	"juniortest/internal/handler"
-	"juniortest/internal/models"
+	"juniortest/internal/notify"
 	"juniortest/internal/repository"
 	"juniortest/internal/service"
 	"log"
+	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
@@ -23,8 +28,104 @@ func main() {
 	// Инициализация репозитория для работы с токенами
 	tokenRepo := repository.NewTokenRepository(cfg.Database.DB)
 
+	// Инициализация связки ключей подписи, выведенные ключи живут не дольше access токенов
+	keyRing, err := newKeyRing(cfg)
+	if err != nil {
+		log.Fatalf("Failed to init signing keys: %v", err)
+	}
+	if cfg.PublishKeys {
+		if err := keyRing.Publishable(); err != nil {
+			log.Fatalf("publish_keys requires asymmetric signing keys (RS*, PS*, ES*, EdDSA): %v", err)
+		}
+	}
+
+	// Доверенные клиенты из конфига, остальные берутся из таблицы clients
+	clientSecrets := make(map[string]string, len(cfg.Clients))
+	for _, client := range cfg.Clients {
+		clientSecrets[client.ClientID] = client.ClientSecretHash
+	}
+
+	// Политика времени жизни токенов
+	tokenPolicy := service.TokenPolicy{
+		Issuer:          cfg.Issuer,
+		Audience:        cfg.Audience,
+		Leeway:          cfg.Leeway,
+		AccessTTL:       cfg.TokenExpiry.AccessToken,
+		RefreshTTL:      cfg.TokenExpiry.RefreshToken,
+		SessionLifetime: cfg.TokenExpiry.SessionLifetime,
+		IdleTimeout:     cfg.TokenExpiry.IdleTimeout,
+		IPChangePolicy:  service.IPChangePolicy(cfg.IPChange),
+		Binding: service.BindingPolicy{
+			IPWeight:          cfg.Binding.IPWeight,
+			UserAgentWeight:   cfg.Binding.UserAgentWeight,
+			FingerprintWeight: cfg.Binding.FingerprintWeight,
+			DeviceWeight:      cfg.Binding.DeviceWeight,
+			WarnThreshold:     cfg.Binding.WarnThreshold,
+			RejectThreshold:   cfg.Binding.RejectThreshold,
+		},
+
+		AuthorizationCodeTTL: cfg.TokenExpiry.AuthorizationCode,
+	}
+
+	// Каталог пользователей, из него же берутся адреса для уведомлений
+	users, err := newUserDirectory(cfg)
+	if err != nil {
+		log.Fatalf("Failed to init user directory: %v", err)
+	}
+
+	// Уведомления пользователей
+	notifier, err := newNotifier(cfg.Notifications)
+	if err != nil {
+		log.Fatalf("Failed to init notifier: %v", err)
+	}
+
+	// Хранилище отозванных access токенов
+	denylist := repository.NewMemoryDenylist()
+	if cfg.Denylist == "postgres" {
+		denylist = repository.NewPostgresDenylist(cfg.Database.DB)
+	}
+
+	// Хранилище jti предъявленных DPoP proof
+	replayCache := repository.NewMemoryReplayCache()
+	if cfg.DPoP.ReplayCache == "postgres" {
+		replayCache = repository.NewPostgresReplayCache(cfg.Database.DB)
+	}
+
+	// TLS сервера, с CA клиентов токены привязываются к клиентским сертификатам
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		log.Fatalf("Failed to init TLS: %v", err)
+	}
+
 	// Инициализация сервиса аутентификации
-	authService := service.NewAuthService(tokenRepo, []byte(cfg.JWTSecretKey))
+	authService := service.NewAuthService(tokenRepo, keyRing, tokenPolicy,
+		service.WithClientAuthenticator(service.NewStaticClientAuthenticator(clientSecrets)),
+		service.WithClientRegistry(repository.NewClientRepository(cfg.Database.DB)),
+		service.WithAuthorizationCodes(repository.NewAuthorizationCodeRepository(cfg.Database.DB)),
+		service.WithDenylist(denylist),
+		service.WithSecurityEvents(repository.NewSecurityEventRepository(cfg.Database.DB)),
+		service.WithUserDirectory(users),
+		service.WithNotifier(notifier, service.NewDirectoryEmailResolver(users)),
+		service.WithCredentials(repository.NewCredentialRepository(cfg.Database.DB), service.LoginPolicy{
+			MaxFailedAttempts: cfg.Login.MaxFailedAttempts,
+			LockoutDuration:   cfg.Login.LockoutDuration,
+		}),
+		service.WithMFA(repository.NewMFARepository(cfg.Database.DB), service.MFAPolicy{
+			Issuer:        cfg.MFA.Issuer,
+			ChallengeTTL:  cfg.MFA.ChallengeTTL,
+			RecoveryCodes: cfg.MFA.RecoveryCodes,
+		}),
+		service.WithScopePolicy(service.ScopePolicy{
+			Default: cfg.Scopes.Default,
+			Roles:   cfg.Scopes.Roles,
+		}),
+		service.WithDPoP(service.DPoPPolicy{
+			ProofLifetime: cfg.DPoP.ProofLifetime,
+			NonceLifetime: cfg.DPoP.NonceLifetime,
+		}, replayCache),
+		service.WithMutualTLS(tlsConfig != nil && tlsConfig.ClientCAs != nil),
+		service.WithPublishedKeys(cfg.PublishKeys),
+	)
 
 	// Инициализация обработчика аутентификации
 	authHandler := handler.NewAuthHandler(authService)
@@ -33,9 +134,38 @@ func main() {
 	router := gin.Default()
 
 	// Определение маршрутов
-	router.GET("/tokens", authHandler.GetTokens)
+	router.POST("/login", authHandler.Login)
+	router.POST("/login/mfa", authHandler.LoginMFA)
 	router.POST("/refresh", authHandler.RefreshToken)
 
+	// Выдача токенов по голому user_id без проверки пароля, только в доверенном внутреннем режиме
+	if cfg.Login.TrustedIssuance {
+		router.GET("/tokens", authHandler.GetTokens)
+	}
+
+	// Подключение второго фактора TOTP, требует access token пользователя
+	router.POST("/mfa/totp/enroll", authHandler.EnrollTOTP)
+	router.POST("/mfa/totp/confirm", authHandler.ConfirmTOTP)
+
+	// Сведения о пользователе и его сессиях по access token
+	router.GET("/userinfo", authHandler.UserInfo)
+	router.GET("/me/sessions", authHandler.Sessions)
+	router.DELETE("/me/sessions/:id", authHandler.DeleteSession)
+
+	// Публичные ключи для проверки access токенов другими сервисами, только для асимметричных ключей
+	if cfg.PublishKeys {
+		router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	}
+
+	// OpenID Connect discovery и стандартный OAuth 2.0 token endpoint
+	router.GET("/.well-known/openid-configuration", authHandler.Discovery)
+	router.GET("/oauth2/authorize", authHandler.Authorize)
+	router.POST("/oauth2/authorize", authHandler.Authorize)
+	router.POST("/oauth2/token", authHandler.Token)
+	router.POST("/introspect", authHandler.Introspect)
+	router.POST("/revoke", authHandler.Revoke)
+	router.POST("/users/:id/logout-all", authHandler.LogoutAll)
+
 	// Маршрут на проверку жизни
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -43,47 +173,121 @@ func main() {
 		})
 	})
 
-	// test router
-	router.GET("/debug/tokens", func(c *gin.Context) {
-		rows, err := cfg.Database.DB.Query("SELECT * FROM refresh_tokens")
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+	// Запуск сервера
+	serverAddr := ":8080" // Можно вынести в конфиг, но не стал т.к это тестовое, плюс так легче :)
+	fmt.Printf("Server starting on %s\n", serverAddr)
+	if tlsConfig == nil {
+		if err := router.Run(serverAddr); err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+		return
+	}
+
+	server := &http.Server{Addr: serverAddr, Handler: router, TLSConfig: tlsConfig}
+	if err := server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
+
+// Создание конфига TLS сервера, nil - сервер работает по HTTP.
+// Клиентский сертификат необязателен: без него клиент получает обычные bearer токены,
+// а предъявленный сертификат обязан быть выпущен CA из client_ca_file.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pemData, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// Создание связки ключей подписи из конфига
+// Если jwt_keys не заданы, используется единственный ключ из jwt_signing
+func newKeyRing(cfg *config.Config) (*service.KeyRing, error) {
+	keyConfigs := cfg.JWTKeys
+	if len(keyConfigs) == 0 {
+		keyID := cfg.JWTSigning.KeyID
+		if keyID == "" {
+			keyID = "default"
 		}
-		defer rows.Close()
-
-		var tokens []models.RefreshTokenData
-		for rows.Next() {
-			var token models.RefreshTokenData
-			err := rows.Scan(
-				&token.ID,
-				&token.UserID,
-				&token.TokenHash,
-				&token.ClientIP,
-				&token.AccessTokenID,
-				&token.CreatedAt,
-				&token.ExpiresAt,
-				&token.Used,
-			)
-			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			tokens = append(tokens, token)
+		keyConfigs = []config.SigningKeyConfig{{
+			ID:             keyID,
+			Algorithm:      cfg.JWTSigning.Algorithm,
+			Secret:         cfg.JWTSecretKey,
+			PrivateKeyFile: cfg.JWTSigning.PrivateKeyFile,
+		}}
+	}
+
+	// Токен, подписанный перед выводом ключа, принимается еще TTL access token плюс допуск на расхождение часов
+	keyRing, err := service.NewKeyRing(cfg.TokenExpiry.AccessToken + cfg.Leeway)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, keyConfig := range keyConfigs {
+		signer, err := service.NewSigner(keyConfig.Algorithm, []byte(keyConfig.Secret), keyConfig.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", keyConfig.ID, err)
 		}
 
-		if err = rows.Err(); err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+		err = keyRing.Add(&service.SigningKey{
+			ID:         keyConfig.ID,
+			Signer:     signer,
+			ActivateAt: keyConfig.ActivateAt,
+			RetireAt:   keyConfig.RetireAt,
+		})
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		c.JSON(200, tokens)
-	})
+	// Без активного ключа сервис не сможет выдавать токены
+	if _, err := keyRing.SigningKey(); err != nil {
+		return nil, err
+	}
 
-	// Запуск сервера
-	serverAddr := ":8080" // Можно вынести в конфиг, но не стал т.к это тестовое, плюс так легче :)
-	fmt.Printf("Server starting on %s\n", serverAddr)
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	return keyRing, nil
+}
+
+// Создание каталога пользователей по драйверу из конфига
+func newUserDirectory(cfg *config.Config) (directory.UserDirectory, error) {
+	switch cfg.UserDirectory.Driver {
+	case "file":
+		return directory.NewFileDirectory(cfg.UserDirectory.File)
+	case "http":
+		if cfg.UserDirectory.URL == "" {
+			return nil, fmt.Errorf("user_directory.url is required for http driver")
+		}
+		return directory.NewHTTPDirectory(cfg.UserDirectory.URL, cfg.UserDirectory.Token, cfg.UserDirectory.Timeout), nil
+	}
+	return directory.NewPostgresDirectory(cfg.Database.DB), nil
+}
+
+// Создание отправителя уведомлений по драйверу из конфига
+func newNotifier(cfg config.NotificationsConfig) (notify.Notifier, error) {
+	if cfg.Driver == "smtp" {
+		return notify.NewSMTPNotifier(notify.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}), nil
 	}
+	return notify.NewLogNotifier(cfg.LogFile)
 }
@@ -2,9 +2,173 @@ CREATE TABLE IF NOT EXISTS refresh_tokens (
     id UUID PRIMARY KEY,
     user_id UUID NOT NULL,
     token_hash TEXT NOT NULL,
+    selector TEXT,
+    family_id UUID,
     client_ip TEXT NOT NULL,
     access_token_id TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL,
     expires_at TIMESTAMP NOT NULL,
-    used BOOLEAN NOT NULL DEFAULT FALSE
-);
\ No newline at end of file
+    session_started_at TIMESTAMP NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked_at TIMESTAMP,
+    revoked_reason TEXT,
+    amr TEXT[],
+    acr TEXT,
+    client_id TEXT,
+    scope TEXT,
+    user_agent TEXT,
+    device_id TEXT,
+    device_fingerprint TEXT,
+    dpop_jkt TEXT,
+    cert_thumbprint TEXT
+);
+
+-- Миграция существующей таблицы: CREATE TABLE IF NOT EXISTS не добавляет новые колонки
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS selector TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS revoked_reason TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS amr TEXT[];
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS acr TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scope TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS device_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS device_fingerprint TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS dpop_jkt TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS cert_thumbprint TEXT;
+
+-- Для токенов, выданных до учета времени сессии, началом сессии считается выдача токена
+UPDATE refresh_tokens SET session_started_at = created_at WHERE session_started_at IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN session_started_at SET NOT NULL;
+
+-- Селектор ищется по индексу, у токенов старого формата он NULL
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_selector_idx ON refresh_tokens (selector);
+
+-- Поиск пары по AccessToken при отзыве и проверке, а также всех токенов пользователя при выходе отовсюду
+CREATE INDEX IF NOT EXISTS refresh_tokens_access_token_id_idx ON refresh_tokens (access_token_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- Отзыв всего семейства ротаций при повторном использовании токена
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- Отозванные access токены, запись удаляется после естественного истечения токена
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    token_id TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_access_tokens_expires_at_idx ON revoked_access_tokens (expires_at);
+
+-- Одноразовые ключи, например jti DPoP proof, запись удаляется, когда proof уже не примут по сроку
+CREATE TABLE IF NOT EXISTS replay_cache (
+    key TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS replay_cache_expires_at_idx ON replay_cache (expires_at);
+
+-- Журнал событий безопасности, например повторного использования refresh token
+CREATE TABLE IF NOT EXISTS security_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    family_id UUID,
+    client_ip TEXT NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Каталог пользователей, токены выдаются только активным пользователям
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY,
+    username TEXT UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'active',
+    roles TEXT[] NOT NULL DEFAULT '{}',
+    password_hash TEXT,
+    failed_logins INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+-- Тестовый пользователь для локального запуска, пароль: test
+INSERT INTO users (id, username, email, status, roles, password_hash)
+VALUES ('123a4567-e89b-12d3-a456-426614174000', 'test', 'test@example.com', 'active', '{user}',
+        '$argon2id$v=19$m=65536,t=1,p=4$+njL9Z1Jad0PUpcNI4DP1Q$AzmYtgG3GfMv76yIgbJxccHEh9WMWmic12Q+OHgTS04')
+ON CONFLICT (id) DO NOTHING;
+
+-- Второй фактор TOTP (RFC 6238), до подтверждения первым кодом confirmed_at пустой и вход идет без него
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id UUID PRIMARY KEY,
+    totp_secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Одноразовые коды восстановления, хранится только SHA-256 хэш
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_code_hash_idx ON mfa_recovery_codes (user_id, code_hash);
+
+-- Реестр OAuth клиентов: секрет хранится в виде bcrypt хэша, TTL в секундах могут только сократить сроки из конфига
+-- У публичных клиентов (SPA, мобильные приложения) секрета нет, они используют authorization_code с PKCE
+CREATE TABLE IF NOT EXISTS clients (
+    client_id TEXT PRIMARY KEY,
+    client_secret_hash TEXT,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    grant_types TEXT[] NOT NULL DEFAULT '{}',
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    audiences TEXT[] NOT NULL DEFAULT '{}',
+    access_token_ttl INTEGER,
+    refresh_token_ttl INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS audiences TEXT[] NOT NULL DEFAULT '{}';
+-- Публичные клиенты хранятся без секрета
+ALTER TABLE clients ALTER COLUMN client_secret_hash DROP NOT NULL;
+
+-- Тестовый клиент для фоновых задач, секрет: reports-secret
+INSERT INTO clients (client_id, client_secret_hash, scopes, grant_types, audiences, access_token_ttl)
+VALUES ('reports-job', '$2a$10$YUoEmGTUlIG.07MOE0UVsOykUjThvb1aTCaBSAAdIVyu3LGq6IKjW',
+        '{reports:read,reports:write}', '{client_credentials}', '{http://localhost:8081}', 300)
+ON CONFLICT (client_id) DO NOTHING;
+
+-- Тестовый публичный клиент для SPA
+INSERT INTO clients (client_id, scopes, grant_types, redirect_uris)
+VALUES ('web-app', '{profile}', '{authorization_code,refresh_token}', '{http://localhost:3000/callback}')
+ON CONFLICT (client_id) DO NOTHING;
+
+-- Одноразовые authorization codes, хранится только SHA-256 хэш кода
+CREATE TABLE IF NOT EXISTS authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    amr TEXT[],
+    acr TEXT,
+    family_id UUID,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE authorization_codes ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
+-- Семейство refresh токенов, которое начнется с обмена кода, отзывается при повторном предъявлении кода
+ALTER TABLE authorization_codes ADD COLUMN IF NOT EXISTS family_id UUID;
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -25,16 +26,132 @@ type DatabaseConfig struct {
 
 // Конфиг токенов
 // Можно было закинуть эту структуру в конфиг приложения, но я решил сделать отдельной, чтобы было проще читать код
+// yaml.v3 сам парсит строки вида "15m" в time.Duration
 type TokenExpiry struct {
-	AccessToken  string `yaml:"access_token"`
-	RefreshToken string `yaml:"refresh_token"`
+	AccessToken     time.Duration `yaml:"access_token"`     // Время жизни access token
+	RefreshToken    time.Duration `yaml:"refresh_token"`    // Время жизни refresh token
+	SessionLifetime time.Duration `yaml:"session_lifetime"` // Абсолютный предел жизни сессии, 0 - без ограничения
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`     // Максимальный перерыв между обновлениями, 0 - без ограничения
+
+	AuthorizationCode time.Duration `yaml:"authorization_code"` // Время жизни authorization code, по умолчанию минута
+}
+
+// Конфиг подписи JWT
+// Для HMAC (HS256/HS384/HS512) используется jwt_secret_key, для RS*, PS*, ES* и EdDSA - приватный ключ из PEM файла
+type SigningConfig struct {
+	KeyID          string `yaml:"key_id"`
+	Algorithm      string `yaml:"algorithm"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+}
+
+// Конфиг ключа в связке для ротации
+// Ключ ожидает до activate_at, подписывает токены до retire_at, а после только проверяет их, пока они не истекут
+type SigningKeyConfig struct {
+	ID             string    `yaml:"id"`
+	Algorithm      string    `yaml:"algorithm"`
+	Secret         string    `yaml:"secret"`
+	PrivateKeyFile string    `yaml:"private_key_file"`
+	ActivateAt     time.Time `yaml:"activate_at"`
+	RetireAt       time.Time `yaml:"retire_at"`
+}
+
+// Конфиг доверенного клиента, которому разрешены служебные эндпоинты вроде /introspect
+type ClientConfig struct {
+	ClientID         string `yaml:"client_id"`
+	ClientSecretHash string `yaml:"client_secret_hash"` // bcrypt хэш client_secret
+}
+
+// Конфиг почтового сервера
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// Конфиг уведомлений пользователей
+type NotificationsConfig struct {
+	Driver  string     `yaml:"driver"`   // smtp или log (моковая отправка в файл или stdout)
+	LogFile string     `yaml:"log_file"` // Файл для драйвера log, пусто - stdout
+	SMTP    SMTPConfig `yaml:"smtp"`
+}
+
+// Конфиг каталога пользователей
+type UserDirectoryConfig struct {
+	Driver  string        `yaml:"driver"`  // postgres (таблица users), file (YAML файл) или http (сервис пользователей)
+	File    string        `yaml:"file"`    // Путь к YAML файлу для драйвера file
+	URL     string        `yaml:"url"`     // Адрес сервиса пользователей для драйвера http
+	Token   string        `yaml:"token"`   // Bearer токен для сервиса пользователей
+	Timeout time.Duration `yaml:"timeout"` // Таймаут запроса к сервису пользователей
+}
+
+// Конфиг входа по паролю
+type LoginConfig struct {
+	MaxFailedAttempts int           `yaml:"max_failed_attempts"` // Неудачных попыток подряд до блокировки
+	LockoutDuration   time.Duration `yaml:"lockout_duration"`    // Длительность блокировки
+	TrustedIssuance   bool          `yaml:"trusted_issuance"`    // Разрешить GET /tokens по голому user_id, только для внутренней сети
+}
+
+// Конфиг второго фактора
+type MFAConfig struct {
+	Issuer        string        `yaml:"issuer"`         // Название сервиса в приложении-аутентификаторе
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl"`  // Время на ввод кода после пароля
+	RecoveryCodes int           `yaml:"recovery_codes"` // Количество кодов восстановления
+}
+
+// Конфиг scope пользовательских токенов
+type ScopesConfig struct {
+	Default []string            `yaml:"default"` // Scope любого пользователя, выдаются и без явного запроса
+	Roles   map[string][]string `yaml:"roles"`   // Дополнительные scope по ролям из каталога пользователей
+}
+
+// Конфиг привязки refresh токенов к устройству: веса изменений и пороги реакции
+type BindingConfig struct {
+	IPWeight          int `yaml:"ip_weight"`
+	UserAgentWeight   int `yaml:"user_agent_weight"`
+	FingerprintWeight int `yaml:"fingerprint_weight"`
+	DeviceWeight      int `yaml:"device_weight"`
+	WarnThreshold     int `yaml:"warn_threshold"`   // С этой суммы весов отправляется письмо, 0 - никогда
+	RejectThreshold   int `yaml:"reject_threshold"` // С этой суммы весов refresh отклоняется, 0 - никогда
+}
+
+// Конфиг DPoP (RFC 9449)
+type DPoPConfig struct {
+	ProofLifetime time.Duration `yaml:"proof_lifetime"` // Насколько старым может быть proof
+	NonceLifetime time.Duration `yaml:"nonce_lifetime"` // Время жизни nonce сервера, 0 - nonce не требуется
+	ReplayCache   string        `yaml:"replay_cache"`   // Хранилище jti предъявленных proof: memory или postgres
+}
+
+// Конфиг TLS сервера, клиентские сертификаты нужны для привязки токенов по RFC 8705
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`      // Сертификат сервера в PEM, пусто - сервер работает по HTTP
+	KeyFile      string `yaml:"key_file"`       // Закрытый ключ сервера в PEM
+	ClientCAFile string `yaml:"client_ca_file"` // CA клиентских сертификатов в PEM, пусто - сертификаты не запрашиваются
 }
 
 // Конфиг приложения
 type Config struct {
-	Database     DatabaseConfig `yaml:"database"`
-	JWTSecretKey string         `yaml:"jwt_secret_key"`
-	TokenExpiry  TokenExpiry    `yaml:"token_expiry"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Issuer        string              `yaml:"issuer"`   // Публичный адрес сервиса для OpenID Connect discovery и claim iss
+	Audience      []string            `yaml:"audience"` // Аудитория токенов по умолчанию (claim aud), пусто - issuer
+	Leeway        time.Duration       `yaml:"leeway"`   // Допуск на расхождение часов при проверке токенов
+	JWTSecretKey  string              `yaml:"jwt_secret_key"`
+	JWTSigning    SigningConfig       `yaml:"jwt_signing"`
+	JWTKeys       []SigningKeyConfig  `yaml:"jwt_keys"`     // Если задано, заменяет jwt_signing
+	PublishKeys   bool                `yaml:"publish_keys"` // Отдавать JWKS для сторонних сервисов, требует асимметричных ключей
+	TokenExpiry   TokenExpiry         `yaml:"token_expiry"`
+	Clients       []ClientConfig      `yaml:"clients"`
+	Denylist      string              `yaml:"denylist"`         // Хранилище отозванных access токенов: memory или postgres
+	IPChange      string              `yaml:"ip_change_policy"` // Реакция на смену IP при refresh: reject, warn или allow
+	Binding       BindingConfig       `yaml:"device_binding"`   // Если задано, заменяет ip_change_policy
+	Notifications NotificationsConfig `yaml:"notifications"`
+	UserDirectory UserDirectoryConfig `yaml:"user_directory"`
+	Login         LoginConfig         `yaml:"login"`
+	MFA           MFAConfig           `yaml:"mfa"`
+	Scopes        ScopesConfig        `yaml:"scopes"`
+	DPoP          DPoPConfig          `yaml:"dpop"`
+	TLS           TLSConfig           `yaml:"tls"`
 }
 
 // Загрузка конфига
@@ -73,24 +190,126 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Парсинг длительности двух токенов
-	accessDuration, err := time.ParseDuration(config.TokenExpiry.AccessToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse access token duration: %w", err)
+	// Адрес сервиса нужен для discovery документа, без слэша на конце
+	config.Issuer = strings.TrimRight(config.Issuer, "/")
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("issuer is required")
 	}
 
-	refreshDuration, err := time.ParseDuration(config.TokenExpiry.RefreshToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse refresh token duration: %w", err)
+	// Без отдельной аудитории токены предназначены самому сервису
+	if len(config.Audience) == 0 {
+		config.Audience = []string{config.Issuer}
+	}
+	if config.Leeway < 0 {
+		return nil, fmt.Errorf("leeway must not be negative")
+	}
+
+	// Хранилище отозванных access токенов
+	switch config.Denylist {
+	case "":
+		config.Denylist = "memory"
+	case "memory", "postgres":
+	default:
+		return nil, fmt.Errorf("unknown denylist storage: %s", config.Denylist)
+	}
+
+	// Политика смены IP, по умолчанию как раньше - отказ
+	switch config.IPChange {
+	case "":
+		config.IPChange = "reject"
+	case "reject", "warn", "allow":
+	default:
+		return nil, fmt.Errorf("unknown ip change policy: %s", config.IPChange)
+	}
+
+	// Веса привязки к устройству не могут быть отрицательными, иначе одно изменение компенсирует другое
+	binding := config.Binding
+	for _, value := range []int{binding.IPWeight, binding.UserAgentWeight, binding.FingerprintWeight, binding.DeviceWeight, binding.WarnThreshold, binding.RejectThreshold} {
+		if value < 0 {
+			return nil, fmt.Errorf("device binding weights and thresholds must not be negative")
+		}
+	}
+
+	// DPoP: по умолчанию proof живет минуту, а jti хранятся в памяти процесса
+	if config.DPoP.ProofLifetime == 0 {
+		config.DPoP.ProofLifetime = time.Minute
+	}
+	if config.DPoP.ProofLifetime < 0 || config.DPoP.NonceLifetime < 0 {
+		return nil, fmt.Errorf("dpop proof and nonce lifetimes must not be negative")
+	}
+	switch config.DPoP.ReplayCache {
+	case "":
+		config.DPoP.ReplayCache = "memory"
+	case "memory", "postgres":
+	default:
+		return nil, fmt.Errorf("unknown dpop replay cache storage: %s", config.DPoP.ReplayCache)
+	}
+
+	// Сертификат и ключ задаются вместе, а проверять клиентов можно только по TLS
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		return nil, fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	if config.TLS.ClientCAFile != "" && config.TLS.CertFile == "" {
+		return nil, fmt.Errorf("tls client_ca_file requires cert_file and key_file")
+	}
+
+	// Драйвер уведомлений
+	switch config.Notifications.Driver {
+	case "":
+		config.Notifications.Driver = "log"
+	case "log", "smtp":
+	default:
+		return nil, fmt.Errorf("unknown notifications driver: %s", config.Notifications.Driver)
+	}
+
+	// Каталог пользователей
+	switch config.UserDirectory.Driver {
+	case "":
+		config.UserDirectory.Driver = "postgres"
+	case "postgres", "file", "http":
+	default:
+		return nil, fmt.Errorf("unknown user directory driver: %s", config.UserDirectory.Driver)
+	}
+	if config.UserDirectory.Timeout <= 0 {
+		config.UserDirectory.Timeout = 5 * time.Second
+	}
+
+	// Параметры блокировки при подборе пароля
+	if config.Login.MaxFailedAttempts <= 0 {
+		config.Login.MaxFailedAttempts = 5
+	}
+	if config.Login.LockoutDuration <= 0 {
+		config.Login.LockoutDuration = 15 * time.Minute
+	}
+
+	// Параметры второго фактора
+	if config.MFA.Issuer == "" {
+		config.MFA.Issuer = "JWTAuthService"
+	}
+	if config.MFA.ChallengeTTL <= 0 {
+		config.MFA.ChallengeTTL = 5 * time.Minute
+	}
+	if config.MFA.RecoveryCodes <= 0 {
+		config.MFA.RecoveryCodes = 10
+	}
+
+	// Проверка длительностей токенов
+	if config.TokenExpiry.AccessToken <= 0 {
+		return nil, fmt.Errorf("access token duration must be positive")
+	}
+
+	if config.TokenExpiry.RefreshToken <= 0 {
+		return nil, fmt.Errorf("refresh token duration must be positive")
+	}
+
+	if config.TokenExpiry.SessionLifetime < 0 || config.TokenExpiry.IdleTimeout < 0 {
+		return nil, fmt.Errorf("session lifetime and idle timeout must not be negative")
+	}
+
+	if config.TokenExpiry.AuthorizationCode <= 0 {
+		config.TokenExpiry.AuthorizationCode = time.Minute
 	}
 
 	// Отдаем конфиг
-	return &Config{
-		Database:     config.Database,
-		JWTSecretKey: config.JWTSecretKey,
-		TokenExpiry: TokenExpiry{
-			AccessToken:  accessDuration.String(),
-			RefreshToken: refreshDuration.String(),
-		},
-	}, nil
+	return &config, nil
 }
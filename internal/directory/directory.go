@@ -0,0 +1,21 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"juniortest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Ошибка, когда пользователя с таким ID нет в каталоге
+var ErrUserNotFound = errors.New("user not found")
+
+// UserDirectory - каталог пользователей: по user_id отдает почту, статус и роли
+type UserDirectory interface {
+	GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error)
+}
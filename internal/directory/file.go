@@ -0,0 +1,62 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/models"
+	"os"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Реализация UserDirectory из статического YAML файла, удобна для локального запуска
+type fileDirectory struct {
+	users map[uuid.UUID]*models.User
+}
+
+// NewFileDirectory читает каталог пользователей из YAML файла вида:
+//
+//	users:
+//	  - id: 123a4567-e89b-12d3-a456-426614174000
+//	    email: user@example.com
+//	    status: active
+//	    roles: [user]
+func NewFileDirectory(path string) (UserDirectory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var file struct {
+		Users []*models.User `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal users file: %w", err)
+	}
+
+	users := make(map[uuid.UUID]*models.User, len(file.Users))
+	for _, user := range file.Users {
+		if _, exists := users[user.ID]; exists {
+			return nil, fmt.Errorf("duplicate user id in users file: %s", user.ID)
+		}
+		users[user.ID] = user
+	}
+
+	return &fileDirectory{users: users}, nil
+}
+
+// GetUser ищет пользователя по ID, возвращается копия, чтобы вызывающий код не менял каталог
+func (d *fileDirectory) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, ok := d.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	result := *user
+	return &result, nil
+}
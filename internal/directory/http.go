@@ -0,0 +1,76 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"juniortest/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Реализация UserDirectory через HTTP запрос к сервису пользователей
+type httpDirectory struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewHTTPDirectory создает каталог, который запрашивает GET {baseURL}/users/{id}.
+// Ответ 200 должен содержать JSON пользователя, 404 означает, что пользователя нет.
+// Если задан token, он передается в заголовке Authorization: Bearer.
+func NewHTTPDirectory(baseURL, token string, timeout time.Duration) UserDirectory {
+	return &httpDirectory{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// GetUser запрашивает пользователя у сервиса пользователей
+func (d *httpDirectory) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	endpoint := d.baseURL + "/users/" + url.PathEscape(userID.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build user request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("user service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUserNotFound
+	default:
+		return nil, fmt.Errorf("user service returned status %d", resp.StatusCode)
+	}
+
+	var user models.User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+
+	// Сервис пользователей не должен подменять ID
+	if user.ID != userID {
+		return nil, fmt.Errorf("user service returned user %s for %s", user.ID, userID)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,51 @@
+package directory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"juniortest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Реализация UserDirectory поверх таблицы users
+type postgresDirectory struct {
+	db *sql.DB
+}
+
+// NewPostgresDirectory создает каталог пользователей из таблицы users
+func NewPostgresDirectory(db *sql.DB) UserDirectory {
+	return &postgresDirectory{db: db}
+}
+
+// GetUser ищет пользователя по ID
+func (d *postgresDirectory) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	// SQL запрос
+	query := `SELECT id, username, email, status, roles FROM users WHERE id = $1`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	var user models.User
+	var username sql.NullString
+	err := d.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&username,
+		&user.Email,
+		&user.Status,
+		pq.Array(&user.Roles),
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+
+	user.Username = username.String
+	return &user, nil
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/service"
+	"juniortest/pkg/dpop"
+	"juniortest/pkg/jose"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Заголовок, в котором клиент может передать постоянный идентификатор своей установки,
+// к нему привязываются refresh токены (см. service.BindingPolicy)
+const deviceIDHeader = "X-Device-ID"
+
+// authenticateUser проверяет access token из заголовка Authorization и при ошибке сам отвечает клиенту
+func (h *AuthHandler) authenticateUser(c *gin.Context) (*jose.Claims, bool) {
+	scheme, token := authorization(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "access token is required"})
+		return nil, false
+	}
+
+	claims, err := h.authService.ValidateAccessToken(context.Background(), token)
+	if err == nil {
+		// Токен, привязанный к сертификату mTLS, принимается только по TLS с этим сертификатом
+		err = h.authService.VerifyCertificateBinding(claims, certThumbprint(c))
+	}
+	if errors.Is(err, service.ErrInvalidAccessToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+		return nil, false
+	}
+	if err != nil {
+		fmt.Printf("Access token validation error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate access token"})
+		return nil, false
+	}
+
+	// Токен, привязанный к ключу DPoP, предъявляется только со схемой DPoP и proof этого ключа,
+	// а bearer токен со схемой DPoP - ошибка клиента (RFC 9449, раздел 7)
+	bound := claims.DPoPKey() != ""
+	if bound != strings.EqualFold(scheme, dpop.Scheme) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+		return nil, false
+	}
+	if bound {
+		err := h.authService.VerifyDPoPBinding(context.Background(), claims, token, dpopProof(c))
+		if errors.Is(err, service.ErrInvalidDPoPProof) {
+			c.Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_dpop_proof"})
+			return nil, false
+		}
+		if err != nil {
+			fmt.Printf("DPoP proof validation error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate access token"})
+			return nil, false
+		}
+	}
+
+	// Токен client_credentials выдан клиенту, а не пользователю
+	if claims.UserID == uuid.Nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user access token is required"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// authorization достает схему и токен из заголовка Authorization: Bearer <token> или DPoP <token>
+func authorization(c *gin.Context) (scheme, token string) {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !(strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, dpop.Scheme)) {
+		return "", ""
+	}
+	return scheme, strings.TrimSpace(token)
+}
+
+// bearerToken достает access token из заголовка Authorization, схема проверяется в authenticateUser
+func bearerToken(c *gin.Context) string {
+	_, token := authorization(c)
+	return token
+}
+
+// dpopProof собирает DPoP proof запроса для проверки сервисом.
+// Несколько заголовков DPoP склеиваются и не пройдут разбор: proof должен быть ровно один.
+func dpopProof(c *gin.Context) service.DPoPProof {
+	return service.DPoPProof{
+		Proof:  strings.Join(c.Request.Header.Values(dpop.Header), ","),
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+	}
+}
+
+// certThumbprint возвращает отпечаток клиентского сертификата TLS, пусто - соединение без проверенного сертификата.
+// Учитываются только сертификаты, прошедшие проверку по CA из конфига.
+func certThumbprint(c *gin.Context) string {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return jose.CertificateThumbprint(state.PeerCertificates[0])
+}
+
+// setDPoPNonce выдает клиенту DPoP свежий nonce в заголовке DPoP-Nonce, если nonce включены.
+// Клиент берет его в следующий proof, в том числе при повторе после ответа use_dpop_nonce.
+func (h *AuthHandler) setDPoPNonce(c *gin.Context) {
+	if c.GetHeader(dpop.Header) == "" {
+		return
+	}
+
+	nonce, err := h.authService.DPoPNonce()
+	if err != nil {
+		fmt.Printf("Failed to issue DPoP nonce: %v\n", err)
+		return
+	}
+	if nonce != "" {
+		c.Header(dpop.NonceHeader, nonce)
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"juniortest/internal/service"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Страница входа для authorization_code, параметры запроса переносятся скрытыми полями
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Вход</title></head>
+<body>
+{{if .Fatal}}
+<p>{{.Error}}</p>
+{{else}}
+<form method="post" action="/oauth2/authorize">
+  <input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+  <input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+  <input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+  <input type="hidden" name="state" value="{{.Request.State}}">
+  <input type="hidden" name="scope" value="{{.Request.Scope}}">
+  <input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+  <input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+  <p>Вход в {{.Request.ClientID}}</p>
+  {{if .Error}}<p>{{.Error}}</p>{{end}}
+  {{if .MFAToken}}
+  <input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+  <label>Код из приложения <input name="code" autocomplete="one-time-code" inputmode="numeric" autofocus></label>
+  {{else}}
+  <label>Логин <input name="login" value="{{.Login}}" autocomplete="username" autofocus></label>
+  <label>Пароль <input name="password" type="password" autocomplete="current-password"></label>
+  {{end}}
+  <button type="submit">Войти</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// Данные для страницы входа
+type authorizePageData struct {
+	Request  service.AuthorizeRequest
+	Login    string
+	MFAToken string
+	Error    string
+	Fatal    bool // Запрос нельзя продолжить и нельзя вернуть клиенту, показывается только ошибка
+}
+
+// Authorize - обработчик для GET и POST /oauth2/authorize (RFC 6749, раздел 4.1 с обязательным PKCE)
+// GET показывает страницу входа, POST проверяет введенные данные и перенаправляет на redirect_uri с кодом
+func (h *AuthHandler) Authorize(c *gin.Context) {
+	// Страницу входа нельзя встраивать во фреймы и кэшировать
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+
+	// Параметры приходят в query при GET и скрытыми полями формы при POST
+	form := c.Request.FormValue
+	request := service.AuthorizeRequest{
+		ResponseType:        form("response_type"),
+		ClientID:            form("client_id"),
+		RedirectURI:         form("redirect_uri"),
+		State:               form("state"),
+		Scope:               form("scope"),
+		CodeChallenge:       form("code_challenge"),
+		CodeChallengeMethod: form("code_challenge_method"),
+	}
+
+	// До проверки клиента и redirect_uri ошибки показываются пользователю, а не отправляются по адресу
+	_, err := h.authService.ValidateAuthorizeRequest(context.Background(), request)
+	if errors.Is(err, service.ErrInvalidClient) || errors.Is(err, service.ErrInvalidRedirectURI) {
+		renderAuthorizePage(c, http.StatusBadRequest, authorizePageData{Error: "Неизвестное приложение или адрес возврата", Fatal: true})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidAuthorizeRequest) {
+		code := oauthInvalidRequest
+		if errors.Is(err, service.ErrUnsupportedResponseType) {
+			code = oauthUnsupportedResponseType
+		}
+		h.authorizeRedirect(c, request, url.Values{"error": {code}, "error_description": {err.Error()}})
+		return
+	}
+	if errors.Is(err, service.ErrUnauthorizedClient) {
+		h.authorizeRedirect(c, request, url.Values{"error": {oauthUnauthorizedClient}})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidScope) {
+		h.authorizeRedirect(c, request, url.Values{"error": {oauthInvalidScope}})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Authorize request error: %v\n", err)
+		renderAuthorizePage(c, http.StatusInternalServerError, authorizePageData{Error: "Сервис временно недоступен", Fatal: true})
+		return
+	}
+
+	page := authorizePageData{Request: request, Login: c.PostForm("login")}
+	if c.Request.Method == http.MethodGet {
+		renderAuthorizePage(c, http.StatusOK, page)
+		return
+	}
+
+	// Вход, обращение к слою сервисов
+	result, err := h.authService.Authorize(context.Background(), service.AuthorizeParams{
+		AuthorizeRequest: request,
+		Login:            page.Login,
+		Password:         c.PostForm("password"),
+		MFAToken:         c.PostForm("mfa_token"),
+		Code:             c.PostForm("code"),
+		ClientIP:         c.ClientIP(),
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrUserNotAllowed):
+		page.Error = "Неверный логин или пароль"
+		renderAuthorizePage(c, http.StatusUnauthorized, page)
+	case errors.Is(err, service.ErrInvalidMFAToken):
+		page.Error = "Время на ввод кода истекло, войдите заново"
+		renderAuthorizePage(c, http.StatusUnauthorized, page)
+	case errors.Is(err, service.ErrInvalidScope):
+		// Пользователю не разрешены запрошенные клиентом scope
+		h.authorizeRedirect(c, request, url.Values{"error": {oauthInvalidScope}})
+	case errors.Is(err, service.ErrInvalidMFACode):
+		page.MFAToken = c.PostForm("mfa_token")
+		page.Error = "Неверный код"
+		renderAuthorizePage(c, http.StatusUnauthorized, page)
+	case err != nil:
+		fmt.Printf("Authorize error: %v\n", err)
+		page.Error = "Не удалось выполнить вход, попробуйте позже"
+		renderAuthorizePage(c, http.StatusInternalServerError, page)
+	case result.MFAToken != "":
+		page.MFAToken = result.MFAToken
+		renderAuthorizePage(c, http.StatusOK, page)
+	default:
+		h.authorizeRedirect(c, request, url.Values{"code": {result.Code}})
+	}
+}
+
+// authorizeRedirect возвращает пользователя на проверенный redirect_uri с результатом и state.
+// Параметр iss защищает клиента от подмены сервера авторизации (RFC 9207).
+func (h *AuthHandler) authorizeRedirect(c *gin.Context, request service.AuthorizeRequest, params url.Values) {
+	target, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		renderAuthorizePage(c, http.StatusBadRequest, authorizePageData{Error: "Некорректный адрес возврата", Fatal: true})
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	query.Set("iss", h.authService.Issuer())
+	target.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// renderAuthorizePage отрисовывает страницу входа
+func renderAuthorizePage(c *gin.Context, status int, data authorizePageData) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := authorizePage.Execute(c.Writer, data); err != nil {
+		fmt.Printf("Failed to render authorize page: %v\n", err)
+	}
+}
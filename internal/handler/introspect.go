@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Introspect - обработчик для POST /introspect (RFC 7662)
+// Доступен только клиентам с учетными данными, иначе эндпоинт превратился бы в оракул для перебора токенов
+func (h *AuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	if !h.authenticateClient(c) {
+		return
+	}
+
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "request must be form-encoded")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "token is required")
+		return
+	}
+
+	result, err := h.authService.Introspect(context.Background(), token)
+	if err != nil {
+		fmt.Printf("Introspection error: %v\n", err)
+		oauthError(c, http.StatusInternalServerError, oauthServerError, "")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
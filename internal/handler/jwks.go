@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Сколько секунд потребители могут кэшировать JWKS, должно быть заметно меньше интервала ротации
+const jwksMaxAge = "300"
+
+// JWKS - обработчик для /.well-known/jwks.json, отдает публичные ключи для проверки access токенов
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	body, err := json.Marshal(h.authService.JWKS())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode key set"})
+		return
+	}
+
+	// ETag считается от содержимого, чтобы клиенты перекачивали набор только после ротации
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("Cache-Control", "public, max-age="+jwksMaxAge)
+	c.Header("ETag", etag)
+
+	// If-None-Match может содержать список тегов через запятую
+	if strings.Contains(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/jwk-set+json", body)
+}
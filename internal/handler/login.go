@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Login - обработчик для POST /login, вход по username или email и паролю
+func (h *AuthHandler) Login(c *gin.Context) {
+	// Логин можно передать в любом из трех полей
+	var request struct {
+		Login    string `json:"login"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Scope    string `json:"scope"` // Запрошенные scope через пробел
+	}
+
+	// Проверка валидности запроса
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	login := firstNonEmpty(request.Login, request.Username, request.Email)
+	if login == "" || request.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login and password are required"})
+		return
+	}
+
+	// Вход, обращение к слою сервисов
+	result, err := h.authService.Login(context.Background(), service.LoginParams{
+		Login:          login,
+		Password:       request.Password,
+		Scope:          request.Scope,
+		ClientIP:       c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		DeviceID:       c.GetHeader(deviceIDHeader),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		CertThumbprint: certThumbprint(c),
+	})
+	if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrUserNotAllowed) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidScope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Login error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+
+	// Либо пара токенов, либо mfa_required и mfa_token для POST /login/mfa
+	c.JSON(http.StatusOK, result)
+}
+
+// firstNonEmpty возвращает первую непустую строку
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
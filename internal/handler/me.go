@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// UserInfo - обработчик для GET /userinfo, возвращает claims владельца access token
+func (h *AuthHandler) UserInfo(c *gin.Context) {
+	claims, ok := h.authenticateUser(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.authService.UserInfo(context.Background(), claims)
+	if errors.Is(err, service.ErrUserNotAllowed) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Userinfo error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user info"})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// Sessions - обработчик для GET /me/sessions, список устройств, где пользователь вошел
+func (h *AuthHandler) Sessions(c *gin.Context) {
+	claims, ok := h.authenticateUser(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(context.Background(), claims)
+	if err != nil {
+		fmt.Printf("List sessions error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// DeleteSession - обработчик для DELETE /me/sessions/:id, выход на одном устройстве
+func (h *AuthHandler) DeleteSession(c *gin.Context) {
+	claims, ok := h.authenticateUser(c)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id format"})
+		return
+	}
+
+	err = h.authService.RevokeSession(context.Background(), claims.UserID, sessionID)
+	if errors.Is(err, service.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Revoke session error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
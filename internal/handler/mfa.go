@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// LoginMFA - обработчик для POST /login/mfa, второй шаг входа после пароля
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	// Код из приложения или код восстановления
+	var request struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	// Проверка валидности запроса
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	if request.MFAToken == "" || (request.Code == "") == (request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and either code or recovery_code are required"})
+		return
+	}
+
+	// Второй шаг входа, обращение к слою сервисов
+	tokens, err := h.authService.CompleteMFALogin(context.Background(), service.MFALoginParams{
+		MFAToken:       request.MFAToken,
+		Code:           request.Code,
+		RecoveryCode:   request.RecoveryCode,
+		ClientIP:       c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		DeviceID:       c.GetHeader(deviceIDHeader),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		CertThumbprint: certThumbprint(c),
+	})
+	if errors.Is(err, service.ErrInvalidMFAToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa_token"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrUserNotAllowed) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidScope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("MFA login error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTOTP - обработчик для POST /mfa/totp/enroll, выдает секрет и otpauth:// URI для QR кода
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	claims, ok := h.authenticateUser(c)
+	if !ok {
+		return
+	}
+
+	provisioning, err := h.authService.EnrollTOTP(context.Background(), claims.UserID)
+	if errors.Is(err, service.ErrMFAAlreadyEnrolled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "totp is already enrolled"})
+		return
+	}
+	if errors.Is(err, service.ErrUserNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("TOTP enrollment error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enroll totp"})
+		return
+	}
+
+	// Секрет показывается один раз и не должен оседать в кэшах
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, provisioning)
+}
+
+// ConfirmTOTP - обработчик для POST /mfa/totp/confirm, подтверждает TOTP первым кодом и выдает коды восстановления
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	claims, ok := h.authenticateUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+
+	// Проверка валидности запроса
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	codes, err := h.authService.ConfirmTOTP(context.Background(), claims.UserID, request.Code)
+	if errors.Is(err, service.ErrMFANotEnrolled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "totp enrollment not started"})
+		return
+	}
+	if errors.Is(err, service.ErrMFAAlreadyEnrolled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "totp is already enrolled"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidMFACode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("TOTP confirmation error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm totp"})
+		return
+	}
+
+	// Коды восстановления показываются один раз
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
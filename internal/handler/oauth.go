@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/service"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Коды ошибок из RFC 6749 (раздел 5.2)
+const (
+	oauthInvalidRequest          = "invalid_request"
+	oauthInvalidClient           = "invalid_client"
+	oauthInvalidGrant            = "invalid_grant"
+	oauthUnauthorizedClient      = "unauthorized_client"
+	oauthInvalidScope            = "invalid_scope"
+	oauthUnsupportedGrantType    = "unsupported_grant_type"
+	oauthUnsupportedResponseType = "unsupported_response_type"
+	oauthServerError             = "server_error"
+)
+
+// Коды ошибок из RFC 9449 (раздел 12.2)
+const (
+	oauthInvalidDPoPProof = "invalid_dpop_proof"
+	oauthUseDPoPNonce     = "use_dpop_nonce"
+)
+
+// Discovery - обработчик для /.well-known/openid-configuration
+func (h *AuthHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.authService.Discovery())
+}
+
+// Token - стандартный OAuth 2.0 token endpoint, параметры принимаются в application/x-www-form-urlencoded
+func (h *AuthHandler) Token(c *gin.Context) {
+	// Ответы token endpoint нельзя кэшировать (RFC 6749, раздел 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	h.setDPoPNonce(c)
+
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "request must be form-encoded")
+		return
+	}
+
+	switch grantType := c.PostForm("grant_type"); grantType {
+	case models.GrantTypeRefreshToken:
+		h.refreshTokenGrant(c)
+	case models.GrantTypeClientCredentials:
+		h.clientCredentialsGrant(c)
+	case models.GrantTypeAuthorizationCode:
+		h.authorizationCodeGrant(c)
+	case "":
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "grant_type is required")
+	default:
+		oauthError(c, http.StatusBadRequest, oauthUnsupportedGrantType, fmt.Sprintf("grant_type %q is not supported", grantType))
+	}
+}
+
+// refreshTokenGrant - grant_type=refresh_token, обертка над AuthService.RefreshToken
+func (h *AuthHandler) refreshTokenGrant(c *gin.Context) {
+	refreshToken := c.PostForm("refresh_token")
+	if refreshToken == "" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "refresh_token is required")
+		return
+	}
+
+	// Токены первой стороны обновляются только вместе с парным access token в нестандартном параметре access_token,
+	// а токены OAuth клиентов - по client_id этого клиента
+	clientID, clientSecret := clientIdentity(c)
+	tokens, err := h.authService.RefreshToken(service.RefreshParams{
+		RefreshToken:   refreshToken,
+		AccessToken:    c.PostForm("access_token"),
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		Scope:          c.PostForm("scope"),
+		ClientIP:       c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		DeviceID:       c.GetHeader(deviceIDHeader),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		DPoP:           dpopProof(c),
+		CertThumbprint: certThumbprint(c),
+	})
+	if err != nil {
+		oauthServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// clientCredentialsGrant - grant_type=client_credentials, токен для самого клиента без пользователя
+func (h *AuthHandler) clientCredentialsGrant(c *gin.Context) {
+	clientID, clientSecret, ok := clientCredentials(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="auth"`)
+		oauthError(c, http.StatusUnauthorized, oauthInvalidClient, "client authentication required")
+		return
+	}
+
+	token, err := h.authService.ClientCredentials(context.Background(), service.ClientCredentialsParams{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		Scope:          c.PostForm("scope"),
+		DPoP:           dpopProof(c),
+		CertThumbprint: certThumbprint(c),
+	})
+	if err != nil {
+		oauthServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// authorizationCodeGrant - grant_type=authorization_code с обязательным PKCE
+func (h *AuthHandler) authorizationCodeGrant(c *gin.Context) {
+	code, codeVerifier := c.PostForm("code"), c.PostForm("code_verifier")
+	if code == "" || codeVerifier == "" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "code and code_verifier are required")
+		return
+	}
+
+	clientID, clientSecret := clientIdentity(c)
+	tokens, err := h.authService.ExchangeAuthorizationCode(context.Background(), service.CodeExchangeParams{
+		Code:           code,
+		RedirectURI:    c.PostForm("redirect_uri"),
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		CodeVerifier:   codeVerifier,
+		ClientIP:       c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		DeviceID:       c.GetHeader(deviceIDHeader),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		DPoP:           dpopProof(c),
+		CertThumbprint: certThumbprint(c),
+	})
+	if err != nil {
+		oauthServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// clientIdentity достает client_id и, если есть, client_secret. Публичные клиенты передают только client_id.
+func clientIdentity(c *gin.Context) (clientID, clientSecret string) {
+	if clientID, clientSecret, ok := clientCredentials(c); ok {
+		return clientID, clientSecret
+	}
+	return c.PostForm("client_id"), ""
+}
+
+// clientCredentials достает client_id и client_secret из Basic авторизации или из тела формы (RFC 6749, раздел 2.3.1)
+func clientCredentials(c *gin.Context) (clientID, clientSecret string, ok bool) {
+	if username, password, hasBasic := c.Request.BasicAuth(); hasBasic {
+		// В Basic авторизации значения дополнительно закодированы как application/x-www-form-urlencoded
+		clientID, errID := url.QueryUnescape(username)
+		clientSecret, errSecret := url.QueryUnescape(password)
+		return clientID, clientSecret, errID == nil && errSecret == nil
+	}
+
+	clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	return clientID, clientSecret, clientID != "" && clientSecret != ""
+}
+
+// authenticateClient проверяет учетные данные клиента и сам отвечает 401, если они неверны
+func (h *AuthHandler) authenticateClient(c *gin.Context) bool {
+	clientID, clientSecret, ok := clientCredentials(c)
+	if ok && h.authService.AuthenticateClient(context.Background(), clientID, clientSecret) == nil {
+		return true
+	}
+
+	c.Header("WWW-Authenticate", `Basic realm="auth"`)
+	oauthError(c, http.StatusUnauthorized, oauthInvalidClient, "client authentication failed")
+	return false
+}
+
+// oauthServiceError переводит ошибку сервиса в ответ RFC 6749
+func oauthServiceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidGrant):
+		oauthError(c, http.StatusBadRequest, oauthInvalidGrant, err.Error())
+		return
+	case errors.Is(err, service.ErrInvalidClient):
+		c.Header("WWW-Authenticate", `Basic realm="auth"`)
+		oauthError(c, http.StatusUnauthorized, oauthInvalidClient, "client authentication failed")
+		return
+	case errors.Is(err, service.ErrUnauthorizedClient):
+		oauthError(c, http.StatusBadRequest, oauthUnauthorizedClient, err.Error())
+		return
+	case errors.Is(err, service.ErrInvalidScope):
+		oauthError(c, http.StatusBadRequest, oauthInvalidScope, err.Error())
+		return
+	case errors.Is(err, service.ErrInvalidDPoPProof):
+		oauthError(c, http.StatusBadRequest, oauthInvalidDPoPProof, err.Error())
+		return
+	case errors.Is(err, service.ErrUseDPoPNonce):
+		// Свежий nonce клиент найдет в заголовке DPoP-Nonce, см. setDPoPNonce
+		oauthError(c, http.StatusBadRequest, oauthUseDPoPNonce, err.Error())
+		return
+	}
+
+	fmt.Printf("OAuth token endpoint error: %v\n", err)
+	oauthError(c, http.StatusInternalServerError, oauthServerError, "")
+}
+
+// oauthError отправляет ошибку в формате RFC 6749
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, models.OAuthError{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Revoke - обработчик для POST /revoke (RFC 7009)
+// Токен без клиента отзывается по факту владения, токен OAuth клиента - только с его учетными данными
+func (h *AuthHandler) Revoke(c *gin.Context) {
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "request must be form-encoded")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, oauthInvalidRequest, "token is required")
+		return
+	}
+
+	clientID, clientSecret := clientIdentity(c)
+	err := h.authService.Revoke(context.Background(), token, clientID, clientSecret)
+	if errors.Is(err, service.ErrInvalidClient) || errors.Is(err, service.ErrUnauthorizedClient) {
+		oauthServiceError(c, err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Revocation error: %v\n", err)
+		oauthError(c, http.StatusServiceUnavailable, oauthServerError, "")
+		return
+	}
+
+	// По RFC 7009 ответ одинаковый и для отозванного, и для неизвестного токена
+	c.Status(http.StatusOK)
+}
+
+// LogoutAll - обработчик для POST /users/:id/logout-all
+// Пользователь может завершить свои сессии своим access token, доверенный клиент - сессии любого пользователя
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id format"})
+		return
+	}
+
+	reason, ok := h.authorizeUserAction(c, userID)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.authService.LogoutAll(context.Background(), userID, reason)
+	if err != nil {
+		fmt.Printf("Logout-all error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// authorizeUserAction проверяет право действовать от имени пользователя и возвращает причину для журнала
+func (h *AuthHandler) authorizeUserAction(c *gin.Context, userID uuid.UUID) (string, bool) {
+	// Self-service: access token самого пользователя
+	if bearerToken(c) != "" {
+		claims, ok := h.authenticateUser(c)
+		if !ok {
+			return "", false
+		}
+		if claims.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return "", false
+		}
+		return models.RevokeReasonLogoutAll, true
+	}
+
+	// Администрирование: доверенный клиент с учетными данными
+	if !h.authenticateClient(c) {
+		return "", false
+	}
+	return models.RevokeReasonAdmin, true
+}
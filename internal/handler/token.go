@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"juniortest/internal/service"
 	"net/http"
@@ -47,10 +48,19 @@ func (h *AuthHandler) GetTokens(c *gin.Context) {
 	clientIP := c.ClientIP()
 
 	// Получение токенов, обращение к слою сервисов
-	tokens, err := h.authService.GetTokens(userID, clientIP)
+	tokens, err := h.authService.GetTokens(userID, clientIP, certThumbprint(c))
+	if errors.Is(err, service.ErrInvalidUserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrInvalidUserID.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrUserNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		// Подробности ошибки (БД, подпись) остаются в логе, клиенту - общий ответ
 		fmt.Printf("Error getting tokens: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue tokens"})
 		return
 	}
 
@@ -58,9 +68,11 @@ func (h *AuthHandler) GetTokens(c *gin.Context) {
 }
 
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	// Структура для получения refresh_token из запроса
+	// Структура для получения refresh_token и парного access_token из запроса
 	var request struct {
 		RefreshToken string `json:"refresh_token"`
+		AccessToken  string `json:"access_token"`
+		Scope        string `json:"scope"` // Необязательное сужение scope
 	}
 
 	// Проверка валидности запроса
@@ -69,11 +81,78 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// Access token можно передать и в заголовке Authorization
+	if request.AccessToken == "" {
+		request.AccessToken = bearerToken(c)
+	}
+
+	if request.RefreshToken == "" || request.AccessToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token and access_token are required"})
+		return
+	}
+
 	// Получение IP-адреса клиента
 	clientIP := c.ClientIP()
+	h.setDPoPNonce(c)
 
 	// Обновление токенов, обращение к слою сервисов
-	tokens, err := h.authService.RefreshToken(request.RefreshToken, clientIP)
+	tokens, err := h.authService.RefreshToken(service.RefreshParams{
+		RefreshToken:   request.RefreshToken,
+		AccessToken:    request.AccessToken,
+		Scope:          request.Scope,
+		ClientIP:       clientIP,
+		UserAgent:      c.Request.UserAgent(),
+		DeviceID:       c.GetHeader(deviceIDHeader),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		DPoP:           dpopProof(c),
+		CertThumbprint: certThumbprint(c),
+	})
+	if errors.Is(err, service.ErrTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token_reused"})
+		return
+	}
+	if errors.Is(err, service.ErrTokenPairMismatch) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token pair mismatch"})
+		return
+	}
+	if errors.Is(err, service.ErrCertificateMismatch) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "certificate mismatch"})
+		return
+	}
+	if errors.Is(err, service.ErrDPoPKeyMismatch) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "dpop key mismatch"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidDPoPProof) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_dpop_proof"})
+		return
+	}
+	if errors.Is(err, service.ErrUseDPoPNonce) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "use_dpop_nonce"})
+		return
+	}
+	if errors.Is(err, service.ErrDeviceMismatch) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "device mismatch"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidScope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+		return
+	}
+	// Остальные отказы по самому токену: не найден, истекла сессия, сменился IP, пользователь заблокирован
+	if errors.Is(err, service.ErrInvalidGrant) || errors.Is(err, service.ErrUserNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidClient) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+	if errors.Is(err, service.ErrUnauthorizedClient) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unauthorized_client"})
+		return
+	}
+	// 500 остается только для сбоев хранилища
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
 		return
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Authorization code (RFC 6749, раздел 4.1) вместе с PKCE challenge (RFC 7636).
+// Сам код в БД не хранится, только его SHA-256 хэш.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectURI   string
+	CodeChallenge string   // BASE64URL(SHA256(code_verifier)), поддерживается только S256
+	Scope         string   // Согласованные scope через пробел
+	AMR           []string // Способ входа пользователя, переходит в токены
+	ACR           string
+	FamilyID      uuid.UUID // Семейство refresh токенов сессии из этого кода, отзывается при повторном предъявлении
+	ExpiresAt     time.Time
+	UsedAt        *time.Time // Момент погашения, код одноразовый
+	CreatedAt     time.Time
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Типы grant_type из RFC 6749, которые может разрешить клиент
+const (
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+// Зарегистрированный OAuth клиент из таблицы clients
+type OAuthClient struct {
+	ClientID         string
+	ClientSecretHash string        // bcrypt хэш client_secret, пусто у публичных клиентов (SPA, мобильные приложения)
+	Scopes           []string      // Scope, которые клиент может запросить
+	GrantTypes       []string      // Разрешенные клиенту grant_type
+	RedirectURIs     []string      // Зарегистрированные redirect_uri для authorization_code
+	Audiences        []string      // Аудитория токенов клиента (claim aud), пусто - по конфигу
+	AccessTokenTTL   time.Duration // Сокращение времени жизни access token, 0 - по конфигу
+	RefreshTokenTTL  time.Duration // Сокращение времени жизни refresh token, 0 - по конфигу
+	CreatedAt        time.Time
+}
+
+// AllowsGrant проверяет, разрешен ли клиенту grant_type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, allowed := range c.GrantTypes {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// Public сообщает, что у клиента нет секрета и он не может аутентифицироваться сам
+func (c *OAuthClient) Public() bool {
+	return c.ClientSecretHash == ""
+}
+
+// AllowsRedirectURI проверяет redirect_uri по точному совпадению с зарегистрированным
+func (c *OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if allowed == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope проверяет, может ли клиент запросить scope
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	for _, allowed := range c.Scopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Ответ token endpoint без refresh token, например для client_credentials (RFC 6749, раздел 4.4.3)
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
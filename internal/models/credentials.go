@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Учетные данные пользователя для входа по паролю
+type UserCredentials struct {
+	UserID       uuid.UUID
+	PasswordHash string
+	FailedLogins int
+	LockedUntil  *time.Time // Блокировка после серии неудачных попыток, nil если не заблокирован
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Методы аутентификации для claim amr (RFC 8176)
+const (
+	AMRPassword = "pwd" // Пароль
+	AMROTP      = "otp" // Одноразовый код TOTP
+	AMRMFA      = "mfa" // Пройдено несколько факторов
+)
+
+// Уровни аутентификации для claim acr, по ним ресурсные серверы требуют step-up
+const (
+	ACRSingleFactor = "aal1" // Один фактор, например только пароль
+	ACRMultiFactor  = "aal2" // Пароль и второй фактор
+)
+
+// Подключенный к учетной записи TOTP (RFC 6238)
+type TOTPEnrollment struct {
+	UserID       uuid.UUID
+	Secret       string     // Секрет в base32, как его вводят в приложение-аутентификатор
+	ConfirmedAt  *time.Time // Момент подтверждения первым кодом, до этого второй фактор не требуется
+	LastUsedStep int64      // Последний принятый временной шаг, один код нельзя ввести дважды
+}
+
+// Данные для подключения приложения-аутентификатора
+type TOTPProvisioning struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // otpauth:// URI для QR кода
+}
+
+// Результат входа по паролю: либо пара токенов, либо требование второго фактора
+type LoginResult struct {
+	*AccessTokenRefreshToken
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`      // Короткоживущий токен для POST /login/mfa
+	MFAExpiresIn int64  `json:"mfa_expires_in,omitempty"` // Через сколько секунд истечет MFAToken
+}
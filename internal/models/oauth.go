@@ -0,0 +1,62 @@
+package models
+
+import "juniortest/pkg/jose"
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Документ OpenID Connect discovery, отдается по /.well-known/openid-configuration
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported,omitempty"`
+	TLSClientCertificateBoundTokens   bool     `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
+
+// Ответ GET /userinfo, стандартные claims OpenID Connect (раздел 5.1) и роли
+type UserInfo struct {
+	Sub               string   `json:"sub"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+	AMR               []string `json:"amr,omitempty"`
+	ACR               string   `json:"acr,omitempty"`
+}
+
+// Ошибка в формате RFC 6749 (раздел 5.2)
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Ответ introspection endpoint (RFC 7662)
+// Для неактивного токена отдается только active=false, чтобы не раскрывать подробности
+type Introspection struct {
+	Active    bool               `json:"active"`
+	TokenType string             `json:"token_type,omitempty"`
+	Sub       string             `json:"sub,omitempty"`
+	Aud       []string           `json:"aud,omitempty"`
+	Iss       string             `json:"iss,omitempty"`
+	Jti       string             `json:"jti,omitempty"`
+	ClientID  string             `json:"client_id,omitempty"`
+	Scope     string             `json:"scope,omitempty"`
+	Exp       int64              `json:"exp,omitempty"`
+	Iat       int64              `json:"iat,omitempty"`
+	Nbf       int64              `json:"nbf,omitempty"`
+	ClientIP  string             `json:"client_ip,omitempty"`
+	TokenID   string             `json:"token_id,omitempty"`
+	AMR       []string           `json:"amr,omitempty"`
+	ACR       string             `json:"acr,omitempty"`
+	Cnf       *jose.Confirmation `json:"cnf,omitempty"`
+}
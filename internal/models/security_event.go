@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Типы событий безопасности
+const (
+	SecurityEventTokenReuse = "refresh_token_reuse"      // Предъявлен уже использованный refresh token
+	SecurityEventCodeReuse  = "authorization_code_reuse" // Предъявлен уже погашенный authorization code
+	SecurityEventDeviceSwap = "device_change"            // Refresh token предъявлен с заметно изменившегося устройства
+)
+
+// Структура данных для хранения события безопасности в базе данных
+type SecurityEvent struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Type      string    `json:"type"`
+	FamilyID  uuid.UUID `json:"family_id"`
+	ClientIP  string    `json:"client_ip"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
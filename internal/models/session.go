@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Сессия пользователя для GET /me/sessions, строится по живому refresh token без его хэша и селектора
+type Session struct {
+	ID              uuid.UUID `json:"id"`                  // Семейство ротаций, не меняется при обновлениях
+	CreatedAt       time.Time `json:"created_at"`          // Момент входа
+	LastRefreshedAt time.Time `json:"last_refreshed_at"`   // Момент выдачи текущего refresh token
+	ExpiresAt       time.Time `json:"expires_at"`          // Срок текущего refresh token
+	ClientIP        string    `json:"client_ip"`           // IP при последнем обновлении
+	UserAgent       string    `json:"user_agent"`          // User-Agent при последнем обновлении
+	DeviceID        string    `json:"device_id,omitempty"` // Идентификатор устройства, если клиент его присылает
+	ClientID        string    `json:"client_id,omitempty"` // OAuth клиент, если вход был через него
+	Current         bool      `json:"current"`             // Сессия, к которой относится access token запроса
+}
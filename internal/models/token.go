@@ -3,7 +3,6 @@ package models
 import (
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -13,26 +12,45 @@ import (
 
 // Структура данных для возврата токенов, AccessToken и RefreshToken
 type AccessTokenRefreshToken struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`         // Через сколько секунд истечет AccessToken
+	RefreshExpiresIn int64  `json:"refresh_expires_in"` // Через сколько секунд истечет RefreshToken
+	Scope            string `json:"scope,omitempty"`    // Выданные scope через пробел
 }
 
 // Структура данных для хранения RefreshToken в базе данных
 type RefreshTokenData struct {
-	ID            uuid.UUID `json:"id"`
-	UserID        uuid.UUID `json:"user_id"`
-	TokenHash     string    `json:"token_hash"`
-	ClientIP      string    `json:"client_ip"`
-	AccessTokenID string    `json:"access_token_id"`
-	CreatedAt     time.Time `json:"created_at"`
-	ExpiresAt     time.Time `json:"expires_at"`
-	Used          bool      `json:"used"`
+	ID                uuid.UUID  `json:"id"`
+	UserID            uuid.UUID  `json:"user_id"`
+	TokenHash         string     `json:"token_hash"`
+	Selector          string     `json:"selector"`
+	FamilyID          uuid.UUID  `json:"family_id"` // Семейство ротаций, наследуется от первого токена сессии
+	ClientIP          string     `json:"client_ip"`
+	AccessTokenID     string     `json:"access_token_id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	SessionStartedAt  time.Time  `json:"session_started_at"` // Момент первичного входа, наследуется при обновлениях
+	Used              bool       `json:"used"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`         // Момент отзыва, nil если токен не отзывался
+	RevokedReason     string     `json:"revoked_reason,omitempty"`     // Причина отзыва, см. RevokeReason*
+	AMR               []string   `json:"amr,omitempty"`                // Методы аутентификации при входе, наследуются при обновлениях
+	ACR               string     `json:"acr,omitempty"`                // Уровень аутентификации при входе
+	ClientID          string     `json:"client_id,omitempty"`          // OAuth клиент, получивший токен через authorization_code
+	Scope             string     `json:"scope,omitempty"`              // Выданные scope через пробел, при обновлении могут только сужаться
+	UserAgent         string     `json:"user_agent,omitempty"`         // User-Agent клиента, получившего токен
+	DeviceID          string     `json:"device_id,omitempty"`          // Идентификатор устройства, который прислал клиент
+	DeviceFingerprint string     `json:"device_fingerprint,omitempty"` // Грубый отпечаток устройства: браузер, ОС, язык
+	DPoPJKT           string     `json:"dpop_jkt,omitempty"`           // Отпечаток ключа DPoP, следующий refresh подтверждается тем же ключом
+	CertThumbprint    string     `json:"cert_thumbprint,omitempty"`    // Отпечаток клиентского сертификата mTLS, следующий refresh только с ним
 }
 
-// Структура данных для хранения Claims в JWT
-type Claims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	TokenID  uuid.UUID `json:"token_id"`
-	ClientIP string    `json:"client_ip"`
-	jwt.RegisteredClaims
-}
+// Причины отзыва RefreshToken, сохраняются в refresh_tokens.revoked_reason
+const (
+	RevokeReasonClient    = "client_revocation" // Клиент отозвал токен через /revoke
+	RevokeReasonLogoutAll = "logout_all"        // Пользователь вышел на всех устройствах
+	RevokeReasonAdmin     = "admin_logout_all"  // Администратор завершил все сессии пользователя
+	RevokeReasonReuse     = "token_reuse"       // Семейство отозвано из-за повторного использования токена
+	RevokeReasonSignOut   = "session_sign_out"  // Пользователь завершил одну сессию через DELETE /me/sessions/{id}
+)
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Статусы пользователя, токены выдаются только активным
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusLocked   = "locked"
+)
+
+// Структура данных пользователя из каталога пользователей
+type User struct {
+	ID       uuid.UUID `json:"id" yaml:"id"`
+	Username string    `json:"username" yaml:"username"`
+	Email    string    `json:"email" yaml:"email"`
+	Status   string    `json:"status" yaml:"status"`
+	Roles    []string  `json:"roles" yaml:"roles"`
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Реализация Notifier, которая вместо отправки пишет письма в файл или в stdout
+// По заданию для упрощения можно использовать моковые данные, поэтому это реализация по умолчанию
+type logNotifier struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogNotifier создает Notifier, дописывающий письма в файл path, пустой path - вывод в stdout
+func NewLogNotifier(path string) (Notifier, error) {
+	if path == "" {
+		return &logNotifier{out: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notification log: %w", err)
+	}
+	return &logNotifier{out: file}, nil
+}
+
+// Notify записывает письмо целиком
+func (n *logNotifier) Notify(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, err := fmt.Fprintf(n.out, "---- EMAIL %s ----\nTo: %s\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// MemoryNotifier - тестовый двойник, складывает письма в память
+type MemoryNotifier struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryNotifier создает пустой MemoryNotifier
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+// Notify сохраняет письмо
+func (n *MemoryNotifier) Notify(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// Messages возвращает копию всех сохраненных писем
+func (n *MemoryNotifier) Messages() []Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	messages := make([]Message, len(n.messages))
+	copy(messages, n.messages)
+	return messages
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Message - письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier отправляет письма пользователям
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// IPChangeWarning - данные для письма о смене IP адреса при обновлении токенов
+type IPChangeWarning struct {
+	To        string
+	OldIP     string
+	NewIP     string
+	Time      time.Time
+	UserAgent string
+	NewDevice bool // Изменилось само устройство, а не только IP адрес
+}
+
+// Шаблон письма о смене IP адреса
+var ipChangeTemplate = template.Must(template.New("ip_change").Parse(`Здравствуйте!
+
+В вашу учетную запись выполнен вход {{if .NewDevice}}с нового устройства{{else}}с нового IP адреса{{end}}.
+
+Прежний IP адрес: {{.OldIP}}
+Новый IP адрес:   {{.NewIP}}
+Время:            {{.Time.UTC.Format "2006-01-02 15:04:05 MST"}}
+Устройство:       {{if .UserAgent}}{{.UserAgent}}{{else}}неизвестно{{end}}
+
+Если это были не вы, завершите все сессии и смените пароль.
+`))
+
+// RenderIPChangeWarning собирает письмо о смене IP адреса по шаблону
+func RenderIPChangeWarning(warning IPChangeWarning) (Message, error) {
+	var body bytes.Buffer
+	if err := ipChangeTemplate.Execute(&body, warning); err != nil {
+		return Message{}, fmt.Errorf("failed to render ip change warning: %w", err)
+	}
+
+	subject := "Вход с нового IP адреса"
+	if warning.NewDevice {
+		subject = "Вход с нового устройства"
+	}
+
+	return Message{
+		To:      warning.To,
+		Subject: subject,
+		Body:    body.String(),
+	}, nil
+}
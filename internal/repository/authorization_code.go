@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Ошибки погашения authorization code
+var (
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	ErrAuthorizationCodeUsed     = errors.New("authorization code already used")
+)
+
+// Описание интерфейса для работы с authorization codes
+type AuthorizationCodeRepository interface {
+	SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error                  // Сохранение нового кода
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) // Атомарное погашение кода по хэшу
+}
+
+// Общий список колонок authorization_codes, чтобы SELECT и Scan не расходились
+const authorizationCodeColumns = `code_hash, client_id, user_id, redirect_uri, code_challenge, scope, COALESCE(amr, '{}'), COALESCE(acr, ''), family_id, expires_at, used_at, created_at`
+
+// Реализация структуры для работы с таблицей authorization_codes
+type authorizationCodeRepository struct {
+	db *sql.DB
+}
+
+// Создание нового экземпляра AuthorizationCodeRepository
+func NewAuthorizationCodeRepository(db *sql.DB) AuthorizationCodeRepository {
+	return &authorizationCodeRepository{db: db}
+}
+
+// Сохранение нового authorization code, заодно удаляются давно истекшие коды
+func (r *authorizationCodeRepository) SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	// SQL запрос
+	query := `
+		INSERT INTO authorization_codes (code_hash, client_id, user_id, redirect_uri, code_challenge, scope, amr, acr, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	_, err := r.db.ExecContext(ctx, query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.CodeChallenge,
+		code.Scope,
+		pq.Array(code.AMR),
+		sql.NullString{String: code.ACR, Valid: code.ACR != ""},
+		uuid.NullUUID{UUID: code.FamilyID, Valid: code.FamilyID != uuid.Nil},
+		code.ExpiresAt,
+		code.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	// Погашенные коды хранятся сутки, чтобы распознавать повторное предъявление, затем удаляются
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM authorization_codes WHERE expires_at < NOW() - INTERVAL '1 day'`); err != nil {
+		fmt.Printf("Failed to purge authorization codes: %v\n", err)
+	}
+	return nil
+}
+
+// Атомарное погашение кода: из параллельных попыток код получит только одна.
+// Если код уже погашен, он возвращается вместе с ErrAuthorizationCodeUsed, чтобы сервис мог записать событие.
+func (r *authorizationCodeRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	// SQL запрос
+	query := `
+		UPDATE authorization_codes
+		SET used_at = NOW()
+		WHERE code_hash = $1 AND used_at IS NULL
+		RETURNING ` + authorizationCodeColumns
+
+	// Выполнение запроса, если строк нет, то код неизвестен или уже погашен
+	code, err := scanAuthorizationCode(r.db.QueryRowContext(ctx, query, codeHash))
+	if err == nil {
+		return code, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	query = `SELECT ` + authorizationCodeColumns + ` FROM authorization_codes WHERE code_hash = $1`
+	code, err = scanAuthorizationCode(r.db.QueryRowContext(ctx, query, codeHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+	return code, ErrAuthorizationCodeUsed
+}
+
+// Сканирование строки authorization_codes, порядок полей соответствует authorizationCodeColumns
+func scanAuthorizationCode(row rowScanner) (*models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+	var familyID uuid.NullUUID
+	var usedAt sql.NullTime
+
+	err := row.Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.CodeChallenge,
+		&code.Scope,
+		pq.Array(&code.AMR),
+		&code.ACR,
+		&familyID,
+		&code.ExpiresAt,
+		&usedAt,
+		&code.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	code.FamilyID = familyID.UUID
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+	return &code, nil
+}
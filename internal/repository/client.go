@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Ошибка, когда клиента с таким client_id нет в реестре
+var ErrClientNotFound = errors.New("client not found")
+
+// Описание интерфейса для реестра OAuth клиентов
+type ClientRepository interface {
+	GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) // Получение клиента по client_id
+}
+
+// Реализация структуры для работы с таблицей clients
+type clientRepository struct {
+	db *sql.DB
+}
+
+// Создание нового экземпляра ClientRepository
+func NewClientRepository(db *sql.DB) ClientRepository {
+	return &clientRepository{db: db}
+}
+
+// Получение клиента по client_id
+func (r *clientRepository) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	// SQL запрос, TTL хранятся в секундах, NULL - по конфигу
+	query := `
+		SELECT client_id, client_secret_hash, scopes, grant_types, redirect_uris, audiences, access_token_ttl, refresh_token_ttl, created_at
+		FROM clients
+		WHERE client_id = $1
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	var client models.OAuthClient
+	var secretHash sql.NullString
+	var accessTokenTTL, refreshTokenTTL sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ClientID,
+		&secretHash,
+		pq.Array(&client.Scopes),
+		pq.Array(&client.GrantTypes),
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Audiences),
+		&accessTokenTTL,
+		&refreshTokenTTL,
+		&client.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+
+	// У публичных клиентов секрета нет
+	client.ClientSecretHash = secretHash.String
+	client.AccessTokenTTL = time.Duration(accessTokenTTL.Int64) * time.Second
+	client.RefreshTokenTTL = time.Duration(refreshTokenTTL.Int64) * time.Second
+	return &client, nil
+}
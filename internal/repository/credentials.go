@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Ошибка, когда пользователя с таким логином нет или у него не задан пароль
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// Описание интерфейса для работы с учетными данными пользователей
+type CredentialRepository interface {
+	GetCredentials(ctx context.Context, login string) (*models.UserCredentials, error)                      // Получение учетных данных по username или email
+	GetCredentialsByID(ctx context.Context, userID uuid.UUID) (*models.UserCredentials, error)              // Получение учетных данных по ID пользователя
+	RecordLoginFailure(ctx context.Context, userID uuid.UUID, maxAttempts int, lockout time.Duration) error // Учет неудачной попытки, блокировка после maxAttempts подряд
+	ResetLoginFailures(ctx context.Context, userID uuid.UUID) error                                         // Сброс счетчика после успешного входа
+}
+
+// Реализация структуры для работы с учетными данными в таблице users
+type credentialRepository struct {
+	db *sql.DB
+}
+
+// Создание нового экземпляра CredentialRepository
+func NewCredentialRepository(db *sql.DB) CredentialRepository {
+	return &credentialRepository{db: db}
+}
+
+// Получение учетных данных по username или email без учета регистра
+func (r *credentialRepository) GetCredentials(ctx context.Context, login string) (*models.UserCredentials, error) {
+	// SQL запрос
+	query := `
+		SELECT id, password_hash, failed_logins, locked_until
+		FROM users
+		WHERE (LOWER(username) = LOWER($1) OR LOWER(email) = LOWER($1)) AND password_hash IS NOT NULL
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	return scanCredentials(r.db.QueryRowContext(ctx, query, login))
+}
+
+// Получение учетных данных по ID пользователя, нужно на шагах входа после пароля
+func (r *credentialRepository) GetCredentialsByID(ctx context.Context, userID uuid.UUID) (*models.UserCredentials, error) {
+	// SQL запрос
+	query := `
+		SELECT id, password_hash, failed_logins, locked_until
+		FROM users
+		WHERE id = $1 AND password_hash IS NOT NULL
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	return scanCredentials(r.db.QueryRowContext(ctx, query, userID))
+}
+
+// Сканирование учетных данных, порядок полей соответствует запросам выше
+func scanCredentials(row rowScanner) (*models.UserCredentials, error) {
+	var credentials models.UserCredentials
+	var lockedUntil sql.NullTime
+	err := row.Scan(
+		&credentials.UserID,
+		&credentials.PasswordHash,
+		&credentials.FailedLogins,
+		&lockedUntil,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrCredentialsNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+
+	if lockedUntil.Valid {
+		credentials.LockedUntil = &lockedUntil.Time
+	}
+	return &credentials, nil
+}
+
+// Учет неудачной попытки входа: счетчик растет атомарно, при достижении maxAttempts
+// пользователь блокируется на lockout, а счетчик начинается заново
+func (r *credentialRepository) RecordLoginFailure(ctx context.Context, userID uuid.UUID, maxAttempts int, lockout time.Duration) error {
+	// SQL запрос
+	query := `
+		UPDATE users SET
+			locked_until = CASE WHEN failed_logins + 1 >= $2 THEN $3::timestamp ELSE locked_until END,
+			failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END
+		WHERE id = $1
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	_, err := r.db.ExecContext(ctx, query, userID, maxAttempts, time.Now().Add(lockout))
+	return err
+}
+
+// Сброс счетчика неудачных попыток после успешного входа
+func (r *credentialRepository) ResetLoginFailures(ctx context.Context, userID uuid.UUID) error {
+	// SQL запрос
+	query := `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Как часто удалять из списка записи об уже истекших токенах
+const denylistPurgeInterval = time.Minute
+
+// Denylist - список отозванных access токенов по token_id (jti).
+// Запись нужна только до естественного истечения токена, после этого она удаляется автоматически.
+type Denylist interface {
+	Add(ctx context.Context, tokenID string, expiresAt time.Time) error // Добавление токена до момента, когда его перестанут принимать (exp плюс leeway)
+	Contains(ctx context.Context, tokenID string) (bool, error)         // Проверка, отозван ли токен
+}
+
+// Реализация Denylist в памяти процесса, подходит для одного экземпляра сервиса
+type memoryDenylist struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time // token_id -> момент истечения токена
+	lastPurge time.Time
+}
+
+// Создание Denylist в памяти
+func NewMemoryDenylist() Denylist {
+	return &memoryDenylist{entries: make(map[string]time.Time), lastPurge: time.Now()}
+}
+
+// Добавление токена в список, заодно периодически вычищаются истекшие записи
+func (d *memoryDenylist) Add(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	now := time.Now()
+	if !expiresAt.After(now) {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[tokenID] = expiresAt
+
+	if now.Sub(d.lastPurge) >= denylistPurgeInterval {
+		for id, exp := range d.entries {
+			if !exp.After(now) {
+				delete(d.entries, id)
+			}
+		}
+		d.lastPurge = now
+	}
+	return nil
+}
+
+// Проверка наличия токена в списке, истекшая запись удаляется сразу
+func (d *memoryDenylist) Contains(ctx context.Context, tokenID string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expiresAt, ok := d.entries[tokenID]
+	if !ok {
+		return false, nil
+	}
+	if !expiresAt.After(time.Now()) {
+		delete(d.entries, tokenID)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Реализация Denylist в Postgres, общая для всех экземпляров сервиса
+type postgresDenylist struct {
+	db        *sql.DB
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// Создание Denylist поверх таблицы revoked_access_tokens
+func NewPostgresDenylist(db *sql.DB) Denylist {
+	return &postgresDenylist{db: db, lastPurge: time.Now()}
+}
+
+// Добавление токена в список, заодно периодически вычищаются истекшие записи
+func (d *postgresDenylist) Add(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if !expiresAt.After(time.Now()) {
+		return nil
+	}
+
+	// SQL запрос, повторное добавление продлевает запись до самого позднего срока
+	query := `
+		INSERT INTO revoked_access_tokens (token_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (token_id) DO UPDATE SET expires_at = GREATEST(revoked_access_tokens.expires_at, EXCLUDED.expires_at)
+	`
+	// Выполнение запроса, если ошибка, то возвращаем её
+	if _, err := d.db.ExecContext(ctx, query, tokenID, expiresAt); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	d.purge(ctx)
+	return nil
+}
+
+// Проверка наличия живой записи о токене
+func (d *postgresDenylist) Contains(ctx context.Context, tokenID string) (bool, error) {
+	// SQL запрос
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE token_id = $1 AND expires_at > NOW())`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	var found bool
+	if err := d.db.QueryRowContext(ctx, query, tokenID).Scan(&found); err != nil {
+		return false, fmt.Errorf("database query error: %v", err)
+	}
+	return found, nil
+}
+
+// Удаление истекших записей не чаще denylistPurgeInterval
+func (d *postgresDenylist) purge(ctx context.Context) {
+	d.mu.Lock()
+	if time.Since(d.lastPurge) < denylistPurgeInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.lastPurge = time.Now()
+	d.mu.Unlock()
+
+	if _, err := d.db.ExecContext(ctx, `DELETE FROM revoked_access_tokens WHERE expires_at <= NOW()`); err != nil {
+		fmt.Printf("Failed to purge revoked access tokens: %v\n", err)
+	}
+}
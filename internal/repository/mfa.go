@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Ошибки работы со вторым фактором
+var (
+	ErrMFANotEnrolled     = errors.New("mfa is not enrolled")
+	ErrMFAAlreadyEnrolled = errors.New("mfa is already enrolled")
+)
+
+// Описание интерфейса для работы со вторым фактором
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTPEnrollment, error)                    // Получение TOTP пользователя
+	SaveTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error                        // Сохранение нового секрета, пока TOTP не подтвержден
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error // Подтверждение TOTP и выпуск кодов восстановления одной транзакцией
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)                      // Атомарное принятие шага, false если этот или более поздний шаг уже использован
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)             // Атомарное погашение кода восстановления, false если кода нет или он использован
+}
+
+// Реализация структуры для работы со вторым фактором в таблицах user_mfa и mfa_recovery_codes
+type mfaRepository struct {
+	db *sql.DB
+}
+
+// Создание нового экземпляра MFARepository
+func NewMFARepository(db *sql.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+// Получение TOTP пользователя, в том числе неподтвержденного
+func (r *mfaRepository) GetTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTPEnrollment, error) {
+	// SQL запрос
+	query := `
+		SELECT user_id, totp_secret, confirmed_at, last_used_step
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	var enrollment models.TOTPEnrollment
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&enrollment.UserID,
+		&enrollment.Secret,
+		&confirmedAt,
+		&enrollment.LastUsedStep,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+
+	if confirmedAt.Valid {
+		enrollment.ConfirmedAt = &confirmedAt.Time
+	}
+	return &enrollment, nil
+}
+
+// Сохранение нового секрета. Неподтвержденный секрет перезаписывается,
+// а подтвержденный TOTP так заменить нельзя - иначе украденный access token позволил бы сменить второй фактор.
+func (r *mfaRepository) SaveTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	// SQL запрос
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret, confirmed_at, last_used_step, created_at)
+		VALUES ($1, $2, NULL, 0, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.confirmed_at IS NULL
+	`
+
+	// Выполнение запроса, если строка не изменилась, то TOTP уже подтвержден
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if rows == 0 {
+		return ErrMFAAlreadyEnrolled
+	}
+	return nil
+}
+
+// Подтверждение TOTP первым кодом. Старые коды восстановления удаляются, новые сохраняются в той же транзакции.
+func (r *mfaRepository) ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Подтверждается только еще не подтвержденный TOTP
+	query := `
+		UPDATE user_mfa
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if rows == 0 {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		query := `
+			INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at)
+			VALUES ($1, $2, $3, NOW())
+		`
+		if _, err := tx.ExecContext(ctx, query, uuid.New(), userID, codeHash); err != nil {
+			return fmt.Errorf("database error: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Атомарное принятие временного шага TOTP.
+// Условный UPDATE не даст принять один и тот же код дважды, даже если запросы пришли одновременно.
+func (r *mfaRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	// SQL запрос
+	query := `
+		UPDATE user_mfa
+		SET last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2
+		RETURNING user_id
+	`
+
+	// Выполнение запроса, если строк нет, то шаг уже использован
+	var id uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, userID, step).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	return true, nil
+}
+
+// Атомарное погашение кода восстановления, каждый код срабатывает один раз
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	// SQL запрос
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		RETURNING id
+	`
+
+	// Выполнение запроса, если строк нет, то код неверный или уже использован
+	var id uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, userID, codeHash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// ReplayCache - одноразовые ключи, например jti DPoP proof.
+// Ключ помнится до истечения срока, за который его еще могут принять, после этого удаляется автоматически.
+type ReplayCache interface {
+	Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error) // Запоминает ключ, false если он уже встречался
+}
+
+// Реализация ReplayCache в памяти процесса, подходит для одного экземпляра сервиса
+type memoryReplayCache struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time // ключ -> момент, после которого его можно забыть
+	lastPurge time.Time
+}
+
+// Создание ReplayCache в памяти
+func NewMemoryReplayCache() ReplayCache {
+	return &memoryReplayCache{entries: make(map[string]time.Time), lastPurge: time.Now()}
+}
+
+// Запоминание ключа, заодно периодически вычищаются истекшие записи
+func (r *memoryReplayCache) Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if exp, ok := r.entries[key]; ok && exp.After(now) {
+		return false, nil
+	}
+	r.entries[key] = expiresAt
+
+	if now.Sub(r.lastPurge) >= denylistPurgeInterval {
+		for k, exp := range r.entries {
+			if !exp.After(now) {
+				delete(r.entries, k)
+			}
+		}
+		r.lastPurge = now
+	}
+	return true, nil
+}
+
+// Реализация ReplayCache в Postgres, общая для всех экземпляров сервиса
+type postgresReplayCache struct {
+	db        *sql.DB
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// Создание ReplayCache поверх таблицы replay_cache
+func NewPostgresReplayCache(db *sql.DB) ReplayCache {
+	return &postgresReplayCache{db: db, lastPurge: time.Now()}
+}
+
+// Запоминание ключа одним запросом: вставка удается, только если живой записи нет
+func (r *postgresReplayCache) Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	// SQL запрос, истекшая запись с тем же ключом перезаписывается
+	query := `
+		INSERT INTO replay_cache (key, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE replay_cache.expires_at <= NOW()
+	`
+	// Выполнение запроса, если ошибка, то возвращаем её
+	result, err := r.db.ExecContext(ctx, query, key, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+
+	r.purge(ctx)
+	return rows == 1, nil
+}
+
+// Удаление истекших записей не чаще denylistPurgeInterval
+func (r *postgresReplayCache) purge(ctx context.Context) {
+	r.mu.Lock()
+	if time.Since(r.lastPurge) < denylistPurgeInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastPurge = time.Now()
+	r.mu.Unlock()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM replay_cache WHERE expires_at <= NOW()`); err != nil {
+		fmt.Printf("Failed to purge replay cache: %v\n", err)
+	}
+}
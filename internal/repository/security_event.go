@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"juniortest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Описание интерфейса для журнала событий безопасности
+type SecurityEventRepository interface {
+	SaveSecurityEvent(ctx context.Context, event *models.SecurityEvent) error // Сохранение события в базе данных
+}
+
+// Реализация структуры для работы с журналом событий
+type securityEventRepository struct {
+	db *sql.DB
+}
+
+// Создание нового экземпляра SecurityEventRepository
+func NewSecurityEventRepository(db *sql.DB) SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+// Сохранение события безопасности в базе данных
+func (r *securityEventRepository) SaveSecurityEvent(ctx context.Context, event *models.SecurityEvent) error {
+	// SQL запрос
+	query := `
+		INSERT INTO security_events (id, user_id, event_type, family_id, client_ip, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	// Событие может быть не привязано к семейству токенов
+	familyID := uuid.NullUUID{UUID: event.FamilyID, Valid: event.FamilyID != uuid.Nil}
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	_, err := r.db.ExecContext(ctx, query,
+		event.ID,
+		event.UserID,
+		event.Type,
+		familyID,
+		event.ClientIP,
+		event.Details,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	return nil
+}
@@ -3,10 +3,12 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"juniortest/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,21 +16,97 @@ import (
 // Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
 // -----------------------------------------------------------------------------------------------
 
+// Ошибка, когда подходящий живой RefreshToken не найден или не совпал хэш
+var ErrRefreshTokenNotFound = errors.New("no valid refresh token found")
+
 // Описание интерфейса для работы с токенами
 type TokenRepository interface {
-	SaveRefreshToken(ctx context.Context, token *models.RefreshTokenData) error              // Сохранение RefreshToken в базе данных
-	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshTokenData, error) // Получение RefreshToken из базы данных по хэшу
-	UpdateRefreshToken(ctx context.Context, token *models.RefreshTokenData) error            // Обновление RefreshToken в базе данных
+	SaveRefreshToken(ctx context.Context, token *models.RefreshTokenData) error                       // Сохранение RefreshToken в базе данных
+	GetRefreshToken(ctx context.Context, selector, verifier string) (*models.RefreshTokenData, error) // Получение RefreshToken по селектору и проверка верификатора
+
+	GetRefreshTokenByAccessTokenID(ctx context.Context, accessTokenID string) (*models.RefreshTokenData, error)       // Получение RefreshToken, выданного вместе с AccessToken
+	RevokeRefreshToken(ctx context.Context, tokenID uuid.UUID, reason string) error                                   // Отзыв одного RefreshToken
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, reason string) ([]*models.RefreshTokenData, error) // Отзыв всех неистекших RefreshToken пользователя
+	RevokeFamily(ctx context.Context, familyID uuid.UUID, reason string) ([]*models.RefreshTokenData, error)          // Отзыв всех токенов семейства ротаций
+	GetActiveRefreshTokens(ctx context.Context, userID uuid.UUID) ([]*models.RefreshTokenData, error)                 // Живые RefreshToken пользователя, по одному на сессию
+
+	ConsumeRefreshToken(ctx context.Context, tokenID uuid.UUID) (bool, error)       // Атомарная отметка RefreshToken как использованного, false если его уже использовали или отозвали
+	WithinTransaction(ctx context.Context, fn func(tx TokenRepository) error) error // Выполнение fn в одной транзакции, ошибка fn откатывает все изменения
+}
+
+// Общий список колонок refresh_tokens, чтобы SELECT и Scan не расходились
+// family_id у токенов, выданных до появления семейств, пустой - такой токен сам себе семейство
+const refreshTokenColumns = `id, user_id, token_hash, selector, COALESCE(family_id, id), client_ip, access_token_id, created_at, expires_at, session_started_at, used, revoked_at, revoked_reason, COALESCE(amr, '{}'), COALESCE(acr, ''), COALESCE(client_id, ''), COALESCE(scope, ''), COALESCE(user_agent, ''), COALESCE(device_id, ''), COALESCE(device_fingerprint, ''), COALESCE(dpop_jkt, ''), COALESCE(cert_thumbprint, '')`
+
+// Интерфейс для сканирования строки, подходит и для *sql.Row, и для *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Общие методы *sql.DB и *sql.Tx, чтобы одни и те же запросы работали и внутри транзакции, и без нее
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 // Реализация структуры для работы с токенами
 type tokenRepository struct {
-	db *sql.DB
+	db   dbtx
+	conn *sql.DB // Подключение для открытия транзакций, nil внутри транзакции
 }
 
 // Создание нового экземпляра TokenRepository, внутри которого будет происходить работа с базой данных
 func NewTokenRepository(db *sql.DB) TokenRepository {
-	return &tokenRepository{db: db}
+	return &tokenRepository{db: db, conn: db}
+}
+
+// Выполнение fn в одной транзакции: при ошибке изменения откатываются, иначе фиксируются.
+// Вложенный вызов выполняется в уже открытой транзакции.
+func (r *tokenRepository) WithinTransaction(ctx context.Context, fn func(tx TokenRepository) error) error {
+	if r.conn == nil {
+		return fn(r)
+	}
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	// После Commit откат ничего не делает, а при панике или ошибке транзакция не повиснет
+	defer tx.Rollback()
+
+	if err := fn(&tokenRepository{db: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Атомарная отметка RefreshToken как использованного.
+// Условный UPDATE блокирует строку: из нескольких параллельных попыток изменит ее только одна,
+// остальные дождутся фиксации и получат false.
+func (r *tokenRepository) ConsumeRefreshToken(ctx context.Context, tokenID uuid.UUID) (bool, error) {
+	// SQL запрос
+	query := `
+		UPDATE refresh_tokens
+		SET used = true
+		WHERE id = $1 AND used = false AND revoked_at IS NULL
+		RETURNING id
+	`
+
+	// Выполнение запроса, если строк нет, то токен уже использован или отозван
+	var id uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, tokenID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	return true, nil
 }
 
 // Сохранение RefreshToken в базе данных
@@ -37,20 +115,35 @@ func (r *tokenRepository) SaveRefreshToken(ctx context.Context, token *models.Re
 
 	// SQL запрос
 	query := `
-		INSERT INTO refresh_tokens (id, user_id, token_hash, client_ip, access_token_id, created_at, expires_at, used)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO refresh_tokens (id, user_id, token_hash, selector, family_id, client_ip, access_token_id, created_at, expires_at, session_started_at, used, amr, acr, client_id, scope, user_agent, device_id, device_fingerprint, dpop_jkt, cert_thumbprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
 	`
 
+	// Старые токены не имеют селектора, поэтому пустая строка пишется как NULL
+	selector := sql.NullString{String: token.Selector, Valid: token.Selector != ""}
+
 	// Выполнение запроса, если ошибка, то возвращаем её
 	result, err := r.db.ExecContext(ctx, query,
 		token.ID,
 		token.UserID,
 		token.TokenHash,
+		selector,
+		token.FamilyID,
 		token.ClientIP,
 		token.AccessTokenID,
 		token.CreatedAt,
 		token.ExpiresAt,
+		token.SessionStartedAt,
 		token.Used,
+		pq.Array(token.AMR),
+		sql.NullString{String: token.ACR, Valid: token.ACR != ""},
+		sql.NullString{String: token.ClientID, Valid: token.ClientID != ""},
+		token.Scope,
+		sql.NullString{String: token.UserAgent, Valid: token.UserAgent != ""},
+		sql.NullString{String: token.DeviceID, Valid: token.DeviceID != ""},
+		sql.NullString{String: token.DeviceFingerprint, Valid: token.DeviceFingerprint != ""},
+		sql.NullString{String: token.DPoPJKT, Valid: token.DPoPJKT != ""},
+		sql.NullString{String: token.CertThumbprint, Valid: token.CertThumbprint != ""},
 	)
 
 	if err != nil {
@@ -64,15 +157,53 @@ func (r *tokenRepository) SaveRefreshToken(ctx context.Context, token *models.Re
 	return err
 }
 
-// Получение RefreshToken из базы данных по хэшу
-func (r *tokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshTokenData, error) {
-	fmt.Printf("Getting refresh tokens from DB for hash: %s\n", tokenHash)
+// Получение RefreshToken из базы данных по селектору
+// Селектор проиндексирован, поэтому достаточно одного запроса и одного сравнения bcrypt.
+// Использованные и отозванные токены тоже возвращаются, чтобы сервис мог распознать повторное использование.
+// Пустой селектор означает токен старого формата, для него остается перебор строк без селектора.
+func (r *tokenRepository) GetRefreshToken(ctx context.Context, selector, verifier string) (*models.RefreshTokenData, error) {
+	if selector == "" {
+		return r.getLegacyRefreshToken(ctx, verifier)
+	}
+
+	fmt.Printf("Getting refresh token from DB for selector: %s\n", selector)
+
+	// SQL-запрос
+	query := `
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE selector = $1 AND expires_at > NOW()
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	token, err := scanRefreshToken(r.db.QueryRowContext(ctx, query, selector))
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+
+	// Сравниваем верификатор с хэшем с помощью bcrypt
+	if err := bcrypt.CompareHashAndPassword([]byte(token.TokenHash), []byte(verifier)); err != nil {
+		fmt.Printf("Token hash comparison failed: %v\n", err)
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	fmt.Printf("Found matching refresh token with ID: %s\n", token.ID)
+	return token, nil
+}
+
+// Получение RefreshToken старого формата (без селектора) перебором живых строк
+// Такие токены перестанут встречаться, как только истекут выданные до перехода на селекторы
+func (r *tokenRepository) getLegacyRefreshToken(ctx context.Context, refreshToken string) (*models.RefreshTokenData, error) {
+	fmt.Printf("Getting legacy refresh tokens from DB\n")
 
 	// SQL-запрос
 	query := `
-		SELECT id, user_id, token_hash, client_ip, access_token_id, created_at, expires_at, used 
-		FROM refresh_tokens 
-		WHERE used = false AND expires_at > NOW()
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE selector IS NULL AND expires_at > NOW()
 	`
 
 	// Выполнение запроса, если ошибка, то возвращаем её
@@ -84,29 +215,18 @@ func (r *tokenRepository) GetRefreshToken(ctx context.Context, tokenHash string)
 
 	// Цикл для получения данных из базы данных
 	for rows.Next() {
-		var token models.RefreshTokenData
-		err := rows.Scan(
-			&token.ID,
-			&token.UserID,
-			&token.TokenHash,
-			&token.ClientIP,
-			&token.AccessTokenID,
-			&token.CreatedAt,
-			&token.ExpiresAt,
-			&token.Used,
-		)
+		token, err := scanRefreshToken(rows)
 		if err != nil {
 			fmt.Printf("Error scanning row: %v\n", err)
 			continue
 		}
 
 		// Сравниваем хэши с помощью bcrypt
-		err = bcrypt.CompareHashAndPassword([]byte(token.TokenHash), []byte(tokenHash))
+		err = bcrypt.CompareHashAndPassword([]byte(token.TokenHash), []byte(refreshToken))
 		if err == nil {
-			fmt.Printf("Found matching refresh token with ID: %s\n", token.ID)
-			return &token, nil
+			fmt.Printf("Found matching legacy refresh token with ID: %s\n", token.ID)
+			return token, nil
 		}
-		fmt.Printf("Token hash comparison failed: %v\n", err)
 	}
 
 	// Проверка ошибок при итерации строк
@@ -114,27 +234,160 @@ func (r *tokenRepository) GetRefreshToken(ctx context.Context, tokenHash string)
 		return nil, fmt.Errorf("error iterating rows: %v", err)
 	}
 
-	return nil, fmt.Errorf("no valid refresh token found")
+	return nil, ErrRefreshTokenNotFound
+}
+
+// Сканирование строки refresh_tokens в структуру, порядок полей соответствует refreshTokenColumns
+func scanRefreshToken(row rowScanner) (*models.RefreshTokenData, error) {
+	var token models.RefreshTokenData
+	var selector, revokedReason sql.NullString
+	var revokedAt sql.NullTime
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&selector,
+		&token.FamilyID,
+		&token.ClientIP,
+		&token.AccessTokenID,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.SessionStartedAt,
+		&token.Used,
+		&revokedAt,
+		&revokedReason,
+		pq.Array(&token.AMR),
+		&token.ACR,
+		&token.ClientID,
+		&token.Scope,
+		&token.UserAgent,
+		&token.DeviceID,
+		&token.DeviceFingerprint,
+		&token.DPoPJKT,
+		&token.CertThumbprint,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Selector = selector.String
+	token.RevokedReason = revokedReason.String
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// Получение RefreshToken, выданного вместе с AccessToken, независимо от его состояния
+func (r *tokenRepository) GetRefreshTokenByAccessTokenID(ctx context.Context, accessTokenID string) (*models.RefreshTokenData, error) {
+	// SQL-запрос
+	query := `
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE access_token_id = $1
+	`
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	token, err := scanRefreshToken(r.db.QueryRowContext(ctx, query, accessTokenID))
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+
+	return token, nil
 }
 
-// Отметка RefreshToken как использованного
-func (r *tokenRepository) MarkTokenAsUsed(ctx context.Context, tokenID uuid.UUID) error {
+// Отзыв одного RefreshToken с указанием причины, повторный отзыв не меняет исходную причину
+func (r *tokenRepository) RevokeRefreshToken(ctx context.Context, tokenID uuid.UUID, reason string) error {
 	// SQL запрос
-	query := `UPDATE refresh_tokens SET used = true WHERE id = $1`
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW(), revoked_reason = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`
 	// Выполнение запроса, если ошибка, то возвращаем её
-	_, err := r.db.ExecContext(ctx, query, tokenID)
+	_, err := r.db.ExecContext(ctx, query, tokenID, reason)
 	return err
 }
 
-// Обновление RefreshToken в базе данных
-func (r *tokenRepository) UpdateRefreshToken(ctx context.Context, token *models.RefreshTokenData) error {
+// Отзыв всех неистекших RefreshToken пользователя, возвращает отозванные строки.
+// Уже использованные строки тоже отзываются, чтобы их access токены попали в denylist.
+func (r *tokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, reason string) ([]*models.RefreshTokenData, error) {
 	// SQL запрос
 	query := `
-		UPDATE refresh_tokens 
-		SET used = $1, access_token_id = $2
-		WHERE id = $3
+		UPDATE refresh_tokens
+		SET revoked_at = NOW(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING ` + refreshTokenColumns
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	rows, err := r.db.QueryContext(ctx, query, userID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	return scanRefreshTokens(rows)
+}
+
+// Отзыв всех неотозванных токенов семейства ротаций, возвращает отозванные строки
+func (r *tokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID, reason string) ([]*models.RefreshTokenData, error) {
+	// SQL запрос, токены старого формата без family_id считаются семейством из одного токена
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW(), revoked_reason = $2
+		WHERE COALESCE(family_id, id) = $1 AND revoked_at IS NULL
+		RETURNING ` + refreshTokenColumns
+
+	// Выполнение запроса, если ошибка, то возвращаем её
+	rows, err := r.db.QueryContext(ctx, query, familyID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	return scanRefreshTokens(rows)
+}
+
+// Получение живых RefreshToken пользователя: неиспользованных, неотозванных и неистекших.
+// После каждой ротации живым остается только последний токен семейства, поэтому строка соответствует сессии.
+func (r *tokenRepository) GetActiveRefreshTokens(ctx context.Context, userID uuid.UUID) ([]*models.RefreshTokenData, error) {
+	// SQL запрос
+	query := `
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE user_id = $1 AND used = false AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
 	`
+
 	// Выполнение запроса, если ошибка, то возвращаем её
-	_, err := r.db.ExecContext(ctx, query, token.Used, token.AccessTokenID, token.ID)
-	return err
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("database query error: %v", err)
+	}
+	defer rows.Close()
+
+	return scanRefreshTokens(rows)
+}
+
+// Сканирование всех строк результата в срез
+func scanRefreshTokens(rows *sql.Rows) ([]*models.RefreshTokenData, error) {
+	var tokens []*models.RefreshTokenData
+	for rows.Next() {
+		token, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	// Проверка ошибок при итерации строк
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return tokens, nil
 }
@@ -4,9 +4,15 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"juniortest/internal/directory"
 	"juniortest/internal/models"
+	"juniortest/internal/notify"
 	"juniortest/internal/repository"
+	"juniortest/pkg/jose"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -15,43 +21,206 @@ import (
 	"github.com/google/uuid"
 )
 
+// Refresh token состоит из публичного селектора и секретного верификатора: base64(selector || verifier).
+// По селектору строка ищется в БД через индекс, а верификатор хранится только в виде bcrypt хэша.
+const (
+	refreshSelectorSize = 16
+	refreshVerifierSize = 32
+)
+
+// TokenPolicy описывает время жизни токенов и сессии
+type TokenPolicy struct {
+	Issuer          string         // Публичный адрес сервиса, claim iss и discovery документ
+	Audience        []string       // Аудитория токенов по умолчанию, claim aud; ее же ждут эндпоинты самого сервиса
+	Leeway          time.Duration  // Допустимое расхождение часов при проверке exp, nbf и iat
+	AccessTTL       time.Duration  // Время жизни access token
+	RefreshTTL      time.Duration  // Время жизни одного refresh token
+	SessionLifetime time.Duration  // Абсолютный предел жизни сессии с момента входа, 0 - без ограничения
+	IdleTimeout     time.Duration  // Скользящий таймаут бездействия между обновлениями, 0 - без ограничения
+	IPChangePolicy  IPChangePolicy // Реакция на смену IP при refresh, по умолчанию отказ
+	Binding         BindingPolicy  // Веса смены IP, User-Agent и устройства при refresh, если не задана - по IPChangePolicy
+
+	AuthorizationCodeTTL time.Duration // Время жизни authorization code
+}
+
+// sessionDeadline возвращает момент, после которого сессия прекращается независимо от обновлений
+func (p TokenPolicy) sessionDeadline(sessionStartedAt time.Time) (time.Time, bool) {
+	if p.SessionLifetime <= 0 {
+		return time.Time{}, false
+	}
+	return sessionStartedAt.Add(p.SessionLifetime), true
+}
+
+// refreshExpiry вычисляет срок жизни нового refresh token с учетом таймаута бездействия и предела сессии
+func (p TokenPolicy) refreshExpiry(now, sessionStartedAt time.Time) time.Time {
+	expiresAt := now.Add(p.RefreshTTL)
+	if p.IdleTimeout > 0 && now.Add(p.IdleTimeout).Before(expiresAt) {
+		expiresAt = now.Add(p.IdleTimeout)
+	}
+	if deadline, ok := p.sessionDeadline(sessionStartedAt); ok && deadline.Before(expiresAt) {
+		expiresAt = deadline
+	}
+	return expiresAt
+}
+
+// accessExpiry вычисляет срок жизни нового access token, он не может пережить сессию
+func (p TokenPolicy) accessExpiry(now, sessionStartedAt time.Time) time.Time {
+	expiresAt := now.Add(p.AccessTTL)
+	if deadline, ok := p.sessionDeadline(sessionStartedAt); ok && deadline.Before(expiresAt) {
+		expiresAt = deadline
+	}
+	return expiresAt
+}
+
 type AuthService struct {
 	tokenRepository repository.TokenRepository
-	jwtSecret       []byte
+	keyRing         *KeyRing
+	policy          TokenPolicy
+	clients         ClientAuthenticator
+	clientRegistry  repository.ClientRepository
+	denylist        repository.Denylist
+	securityEvents  repository.SecurityEventRepository
+	notifier        notify.Notifier
+	emails          EmailResolver
+	users           directory.UserDirectory
+	credentials     repository.CredentialRepository
+	loginPolicy     LoginPolicy
+	mfa             repository.MFARepository
+	mfaPolicy       MFAPolicy
+	codes           repository.AuthorizationCodeRepository
+	scopePolicy     ScopePolicy
+	dpopPolicy      DPoPPolicy
+	replay          repository.ReplayCache // Одноразовые ключи: jti DPoP proof и погашенных mfa токенов
+	mutualTLS       bool
+	publishKeys     bool
+}
+
+// Option - необязательная зависимость AuthService
+type Option func(*AuthService)
+
+// WithClientAuthenticator задает проверку учетных данных клиентов для служебных эндпоинтов
+func WithClientAuthenticator(clients ClientAuthenticator) Option {
+	return func(as *AuthService) {
+		as.clients = clients
+	}
+}
+
+// WithDenylist задает хранилище отозванных access токенов, по умолчанию используется память процесса
+func WithDenylist(denylist repository.Denylist) Option {
+	return func(as *AuthService) {
+		as.denylist = denylist
+	}
+}
+
+// WithSecurityEvents задает журнал событий безопасности, без него события только пишутся в лог
+func WithSecurityEvents(securityEvents repository.SecurityEventRepository) Option {
+	return func(as *AuthService) {
+		as.securityEvents = securityEvents
+	}
 }
 
-func NewAuthService(tokenRepository repository.TokenRepository, jwtSecret []byte) *AuthService {
-	return &AuthService{
+// WithNotifier задает отправку писем пользователям и способ узнать их адрес
+func WithNotifier(notifier notify.Notifier, emails EmailResolver) Option {
+	return func(as *AuthService) {
+		as.notifier = notifier
+		as.emails = emails
+	}
+}
+
+func NewAuthService(tokenRepository repository.TokenRepository, keyRing *KeyRing, policy TokenPolicy, opts ...Option) *AuthService {
+	as := &AuthService{
 		tokenRepository: tokenRepository,
-		jwtSecret:       jwtSecret,
+		keyRing:         keyRing,
+		policy:          policy,
+		clients:         NewStaticClientAuthenticator(nil),
+		denylist:        repository.NewMemoryDenylist(),
+		dpopPolicy:      defaultDPoPPolicy,
+		replay:          repository.NewMemoryReplayCache(),
+	}
+	for _, opt := range opts {
+		opt(as)
 	}
+	return as
 }
 
 // generateAccessToken создает новый access token
-func (as *AuthService) generateAccessToken(tokenID uuid.UUID, userID uuid.UUID, clientIP string) (string, error) {
-	claims := jwt.MapClaims{
-		"token_id":  tokenID.String(),
-		"user_id":   userID.String(),
-		"client_ip": clientIP,
-		"exp":       time.Now().Add(time.Minute * 15).Unix(),
+func (as *AuthService) generateAccessToken(tokenID uuid.UUID, g grant, expiresAt time.Time) (string, error) {
+	// Способ входа попадает в токен, чтобы ресурсные серверы могли потребовать второй фактор,
+	// а scope и роли - чтобы они могли проверить права без обращения к сервису.
+	// iss и aud не дают предъявить токен другому сервису, jti совпадает с token_id.
+	now := time.Now()
+	claims := &jose.Claims{
+		UserID:   g.UserID,
+		TokenID:  tokenID,
+		ClientIP: g.ClientIP,
+		AMR:      g.AMR,
+		ACR:      g.ACR,
+		Scope:    g.Scope,
+		Roles:    g.Roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    as.policy.Issuer,
+			Subject:   g.UserID.String(),
+			Audience:  as.audience(g.Audience),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        tokenID.String(),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(as.jwtSecret)
+	// Токен, выданный OAuth клиенту, несет его идентификатор (RFC 9068)
+	if g.ClientID != "" {
+		claims.ClientID = g.ClientID
+		claims.AZP = g.ClientID
+	}
+
+	// Токен, привязанный к ключу DPoP или сертификату mTLS, принимается только вместе с ними
+	claims.Cnf = confirmation(g.DPoPJKT, g.CertThumbprint)
+
+	return as.signToken(claims, "")
 }
 
-// generateRefreshToken создает новый refresh token
-func (as *AuthService) generateRefreshToken(tokenID uuid.UUID, userID uuid.UUID, clientIP string) (string, error) {
-	fmt.Printf("Processing GetTokens for user_id: %s, clientIP: %s\n", userID, clientIP)
+// signToken подписывает claims активным ключом из связки, его идентификатор кладется в заголовок kid.
+// Непустой typ заменяет стандартный заголовок typ, чтобы токены разного назначения нельзя было перепутать.
+func (as *AuthService) signToken(claims jwt.Claims, typ string) (string, error) {
+	key, err := as.keyRing.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Signer.Method(), claims)
+	token.Header["kid"] = key.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return key.Signer.Sign(token)
+}
 
-	// Генерация случайного токена
-	b := make([]byte, 32)
+// generateRefreshToken создает новый refresh token и возвращает его вместе с селектором и верификатором
+func (as *AuthService) generateRefreshToken() (token, selector, verifier string, err error) {
+	// Генерация случайных селектора и верификатора одним буфером
+	b := make([]byte, refreshSelectorSize+refreshVerifierSize)
 	if _, err := rand.Read(b); err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
 	// Кодирование в base64 самого токена
-	return base64.StdEncoding.EncodeToString(b), nil
+	token = base64.StdEncoding.EncodeToString(b)
+	selector, verifier = splitRefreshToken(token)
+	return token, selector, verifier, nil
+}
+
+// splitRefreshToken разбирает refresh token на селектор и верификатор.
+// Для токенов старого формата (32 случайных байта без селектора) селектор пустой, а верификатором служит весь токен.
+func splitRefreshToken(token string) (selector, verifier string) {
+	b, err := base64.StdEncoding.DecodeString(token)
+	if err != nil || len(b) != refreshSelectorSize+refreshVerifierSize {
+		return "", token
+	}
+
+	selector = hex.EncodeToString(b[:refreshSelectorSize])
+	verifier = base64.StdEncoding.EncodeToString(b[refreshSelectorSize:])
+	return selector, verifier
 }
 
 // generateTokenHash создает bcrypt хэш для refresh token
@@ -64,19 +233,18 @@ func generateTokenHash(token string) (string, error) {
 	return string(hash), nil
 }
 
-// GetTokens обращается к CreateTokenPair для создания пары токенов
-func (as *AuthService) GetTokens(userID string, clientIP string) (*models.AccessTokenRefreshToken, error) {
-	fmt.Printf("GetTokens called with userID: %s, clientIP: %s\n", userID, clientIP)
-
+// GetTokens обращается к CreateTokenPair для создания пары токенов.
+// certThumbprint - отпечаток клиентского сертификата mTLS, пусто - токены не привязываются.
+func (as *AuthService) GetTokens(userID string, clientIP string, certThumbprint string) (*models.AccessTokenRefreshToken, error) {
 	// Преобразование userID из строки в UUID
 	uid, err := uuid.Parse(userID)
 	if err != nil {
 		fmt.Printf("Error parsing UUID: %v\n", err)
-		return nil, fmt.Errorf("invalid user_id format: %v", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserID, err)
 	}
 
 	// Создание пары токенов
-	tokens, err := as.CreateTokenPair(context.Background(), uid, clientIP)
+	tokens, err := as.CreateTokenPair(context.Background(), uid, clientIP, certThumbprint)
 	if err != nil {
 		fmt.Printf("Error creating token pair: %v\n", err)
 		return nil, err
@@ -85,15 +253,97 @@ func (as *AuthService) GetTokens(userID string, clientIP string) (*models.Access
 	return tokens, nil
 }
 
-// CreateTokenPair создает пару токенов
-func (as *AuthService) CreateTokenPair(ctx context.Context, userID uuid.UUID, clientIP string) (*models.AccessTokenRefreshToken, error) {
-	fmt.Printf("CreateTokenPair started for userID: %s, clientIP: %s\n", userID, clientIP)
+// grant - кому и на основании какого входа выдается пара токенов
+type grant struct {
+	UserID         uuid.UUID
+	ClientIP       string
+	UserAgent      string    // Показывается пользователю в списке сессий
+	DeviceID       string    // Идентификатор устройства от клиента, может быть пустым
+	Fingerprint    string    // Грубый отпечаток устройства, см. deviceFingerprint
+	AMR            []string  // Методы аутентификации при входе (RFC 8176), пусто - вход без проверки учетных данных
+	ACR            string    // Достигнутый уровень аутентификации
+	ClientID       string    // OAuth клиент, через которого выдается пара, пусто - первая сторона
+	Scope          string    // Запрошенные scope через пробел, после проверки - выданные
+	Roles          []string  // Роли пользователя из каталога
+	Audience       []string  // Аудитория клиента, пусто - по политике
+	DPoPJKT        string    // Отпечаток ключа DPoP, к которому привязывается пара, пусто - bearer токены
+	CertThumbprint string    // Отпечаток клиентского сертификата mTLS, к которому привязывается пара
+	FamilyID       uuid.UUID // Семейство новой сессии, назначенное заранее (authorization code), пусто - ID первого refresh token
+
+	Client     *models.OAuthClient // Клиент из реестра, ограничивает доступные scope
+	AccessTTL  time.Duration       // Переопределение времени жизни access token клиентом, 0 - по политике
+	RefreshTTL time.Duration       // Переопределение времени жизни refresh token клиентом, 0 - по политике
+}
+
+// clientGrant дополняет grant настройками OAuth клиента
+func (as *AuthService) clientGrant(g grant, client *models.OAuthClient) grant {
+	g.ClientID = client.ClientID
+	g.Client = client
+	g.Audience = client.Audiences
+	g.AccessTTL = as.clientAccessTTL(client)
+	g.RefreshTTL = as.clientRefreshTTL(client)
+	return g
+}
+
+// CreateTokenPair создает пару токенов для новой сессии, если пользователь известен и активен.
+// С отпечатком клиентского сертификата пара привязывается к нему (RFC 8705).
+func (as *AuthService) CreateTokenPair(ctx context.Context, userID uuid.UUID, clientIP, certThumbprint string) (*models.AccessTokenRefreshToken, error) {
+	return as.startSession(ctx, grant{UserID: userID, ClientIP: clientIP, CertThumbprint: certThumbprint})
+}
+
+// startSession проверяет пользователя и запрошенные scope и начинает новую сессию
+func (as *AuthService) startSession(ctx context.Context, g grant) (*models.AccessTokenRefreshToken, error) {
+	user, err := as.checkUser(ctx, g.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.Scope, err = as.sessionScope(g.Scope, user, g.Client); err != nil {
+		return nil, err
+	}
+	if user != nil {
+		g.Roles = user.Roles
+	}
+
+	return as.issueTokenPair(ctx, as.tokenRepository, g, nil)
+}
+
+// issueTokenPair создает пару токенов. Если передан parent, новая пара продолжает его сессию:
+// наследуются момент входа, способ входа и семейство токенов, иначе начинается новая сессия с новым семейством.
+// Refresh token сохраняется через repo, чтобы при ротации вставка шла в той же транзакции.
+func (as *AuthService) issueTokenPair(ctx context.Context, repo repository.TokenRepository, g grant, parent *models.RefreshTokenData) (*models.AccessTokenRefreshToken, error) {
+	userID, clientIP := g.UserID, g.ClientIP
 
 	accessTokenID := uuid.New()  // Генерация ID для AccessToken
 	refreshTokenID := uuid.New() // Генерация ID для RefreshToken
 
+	// Новая сессия начинается сейчас, а семейство получает ID первого refresh token
+	now := time.Now()
+	sessionStartedAt, familyID := now, refreshTokenID
+	if g.FamilyID != uuid.Nil {
+		familyID = g.FamilyID
+	}
+	if parent != nil {
+		sessionStartedAt, familyID = parent.SessionStartedAt, parent.FamilyID
+		g.AMR, g.ACR, g.ClientID = parent.AMR, parent.ACR, parent.ClientID
+	}
+
+	// Сроки жизни токенов по политике с учетом переопределений клиента
+	policy := as.policy
+	if g.AccessTTL > 0 {
+		policy.AccessTTL = g.AccessTTL
+	}
+	if g.RefreshTTL > 0 {
+		policy.RefreshTTL = g.RefreshTTL
+	}
+	accessExpiresAt := policy.accessExpiry(now, sessionStartedAt)
+	refreshExpiresAt := policy.refreshExpiry(now, sessionStartedAt)
+	if !refreshExpiresAt.After(now) {
+		return nil, ErrSessionExpired
+	}
+
 	// Генерация AccessToken
-	accessToken, err := as.generateAccessToken(accessTokenID, userID, clientIP)
+	accessToken, err := as.generateAccessToken(accessTokenID, g, accessExpiresAt)
 	if err != nil {
 		fmt.Printf("Error generating access token: %v\n", err)
 		return nil, fmt.Errorf("failed to generate access token: %v", err)
@@ -101,15 +351,15 @@ func (as *AuthService) CreateTokenPair(ctx context.Context, userID uuid.UUID, cl
 	fmt.Printf("Access token generated successfully\n")
 
 	// Генерация RefreshToken
-	refreshToken, err := as.generateRefreshToken(refreshTokenID, userID, clientIP)
+	refreshToken, selector, verifier, err := as.generateRefreshToken()
 	if err != nil {
 		fmt.Printf("Error generating refresh token: %v\n", err)
 		return nil, fmt.Errorf("failed to generate refresh token: %v", err)
 	}
 	fmt.Printf("Refresh token generated successfully\n")
 
-	// Создание хэша
-	tokenHash, err := generateTokenHash(refreshToken)
+	// Создание хэша, в БД хранится только хэш верификатора
+	tokenHash, err := generateTokenHash(verifier)
 	if err != nil {
 		fmt.Printf("Error generating token hash: %v\n", err)
 		return nil, fmt.Errorf("failed to hash refresh token: %v", err)
@@ -117,20 +367,32 @@ func (as *AuthService) CreateTokenPair(ctx context.Context, userID uuid.UUID, cl
 	fmt.Printf("Token hash generated successfully\n")
 
 	refreshTokenData := &models.RefreshTokenData{
-		ID:            refreshTokenID,
-		UserID:        userID,
-		TokenHash:     tokenHash,
-		ClientIP:      clientIP,
-		AccessTokenID: accessTokenID.String(),
-		CreatedAt:     time.Now(),
-		ExpiresAt:     time.Now().Add(time.Hour * 24),
-		Used:          false,
+		ID:                refreshTokenID,
+		UserID:            userID,
+		TokenHash:         tokenHash,
+		Selector:          selector,
+		FamilyID:          familyID,
+		ClientIP:          clientIP,
+		AccessTokenID:     accessTokenID.String(),
+		CreatedAt:         now,
+		ExpiresAt:         refreshExpiresAt,
+		SessionStartedAt:  sessionStartedAt,
+		Used:              false,
+		AMR:               g.AMR,
+		ACR:               g.ACR,
+		ClientID:          g.ClientID,
+		Scope:             g.Scope,
+		UserAgent:         g.UserAgent,
+		DeviceID:          g.DeviceID,
+		DeviceFingerprint: g.Fingerprint,
+		DPoPJKT:           g.DPoPJKT,
+		CertThumbprint:    g.CertThumbprint,
 	}
 
 	fmt.Printf("Attempting to save refresh token to DB with ID: %s\n", refreshTokenData.ID)
 
 	// Сохранение в БД с подробным логированием ошибки
-	if err := as.tokenRepository.SaveRefreshToken(ctx, refreshTokenData); err != nil {
+	if err := repo.SaveRefreshToken(ctx, refreshTokenData); err != nil {
 		fmt.Printf("Detailed DB error: %+v\n", err)
 		return nil, fmt.Errorf("failed to save refresh token to database: %v", err)
 	}
@@ -138,47 +400,264 @@ func (as *AuthService) CreateTokenPair(ctx context.Context, userID uuid.UUID, cl
 	fmt.Printf("Successfully saved refresh token to DB\n")
 
 	return &models.AccessTokenRefreshToken{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:      accessToken,
+		TokenType:        tokenType(g.DPoPJKT),
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(accessExpiresAt.Sub(now).Seconds()),
+		RefreshExpiresIn: int64(refreshExpiresAt.Sub(now).Seconds()),
+		Scope:            g.Scope,
 	}, nil
 }
 
-// RefreshToken обновляет пару токенов, используя refresh token
-func (as *AuthService) RefreshToken(refreshToken string, clientIP string) (*models.AccessTokenRefreshToken, error) {
-	fmt.Printf("Attempting to refresh token for client IP: %s\n", clientIP)
+// RefreshParams - входные данные операции Refresh
+type RefreshParams struct {
+	RefreshToken   string    // Предъявленный refresh token
+	AccessToken    string    // Access token, выданный вместе с ним, может быть уже истекшим
+	ClientID       string    // OAuth клиент, обязателен для токенов, выданных через authorization_code
+	ClientSecret   string    // Секрет конфиденциального клиента
+	Scope          string    // Запрошенные scope, могут только сузить scope сессии, пусто - оставить как есть
+	ClientIP       string    // IP адрес клиента
+	UserAgent      string    // User-Agent клиента, попадает в письмо о смене IP
+	DeviceID       string    // Идентификатор устройства от клиента, если он его присылает
+	AcceptLanguage string    // Заголовок Accept-Language, часть отпечатка устройства
+	DPoP           DPoPProof // Proof из заголовка DPoP, пусто - клиент не использует DPoP
+	CertThumbprint string    // Отпечаток клиентского сертификата mTLS, пусто - клиент без сертификата
+}
+
+// RefreshToken обновляет пару токенов, используя refresh token и парный ему access token
+func (as *AuthService) RefreshToken(params RefreshParams) (*models.AccessTokenRefreshToken, error) {
+	clientIP := params.ClientIP
 
-	// Получение данных из БД и сравнение хэшей
-	tokenData, err := as.tokenRepository.GetRefreshToken(context.Background(), refreshToken)
+	// Получение данных из БД по селектору и сравнение хэшей
+	selector, verifier := splitRefreshToken(params.RefreshToken)
+	tokenData, err := as.tokenRepository.GetRefreshToken(context.Background(), selector, verifier)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		fmt.Printf("Refresh token not found\n")
+		return nil, ErrInvalidRefreshToken
+	}
 	if err != nil {
 		fmt.Printf("Error getting refresh token from DB: %v\n", err)
 		return nil, fmt.Errorf("failed to get refresh token: %v", err)
 	}
 
-	// Проверка использования токена
+	// Повторное предъявление уже использованного токена означает кражу одной из копий:
+	// отзываем все семейство, включая токены, выданные после ротации
 	if tokenData.Used {
-		fmt.Printf("Refresh token already used\n")
-		return nil, fmt.Errorf("refresh token already used")
+		fmt.Printf("Refresh token reuse detected for family %s\n", tokenData.FamilyID)
+		if err := as.revokeFamily(context.Background(), tokenData, clientIP); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+
+	// Отозванный токен просто недействителен
+	if tokenData.RevokedAt != nil {
+		fmt.Printf("Refresh token revoked: %s\n", tokenData.RevokedReason)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Устройство, с которого пришел запрос, новая пара будет привязана к нему
+	current := newDevice(clientIP, params.UserAgent, params.DeviceID, params.AcceptLanguage)
+	g := grant{
+		UserID:      tokenData.UserID,
+		ClientIP:    clientIP,
+		UserAgent:   params.UserAgent,
+		DeviceID:    current.DeviceID,
+		Fingerprint: current.Fingerprint,
+	}
+
+	// Токен OAuth клиента обновляет только тот же клиент (RFC 6749, раздел 6).
+	// Стандартные клиенты не отправляют access token, поэтому для них парность проверяется, только если он передан.
+	var client *models.OAuthClient
+	if tokenData.ClientID != "" {
+		client, err = as.checkRefreshClient(context.Background(), tokenData, params.ClientID, params.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		g = as.clientGrant(g, client)
+	}
+
+	// Refresh выполняется только тем refresh token, который был выдан вместе с access token
+	if tokenData.ClientID == "" || params.AccessToken != "" {
+		if err := as.checkTokenPair(params.AccessToken, tokenData); err != nil {
+			return nil, err
+		}
+	}
+
+	// Токен, привязанный к ключу DPoP, обновляется только с proof того же ключа.
+	// Непривязанный токен привязывается к ключу, которым клиент впервые подтвердил обновление.
+	jkt, err := as.checkDPoPProof(context.Background(), params.DPoP)
+	if err != nil {
+		return nil, err
+	}
+	if tokenData.DPoPJKT != "" && jkt != tokenData.DPoPJKT {
+		fmt.Printf("Refresh token %s is bound to another DPoP key\n", tokenData.ID)
+		return nil, ErrDPoPKeyMismatch
+	}
+	g.DPoPJKT = jkt
+
+	// Токен, привязанный к сертификату mTLS, обновляется только по TLS с тем же сертификатом (RFC 8705, раздел 3)
+	if tokenData.CertThumbprint != "" && params.CertThumbprint != tokenData.CertThumbprint {
+		fmt.Printf("Refresh token %s is bound to another client certificate\n", tokenData.ID)
+		return nil, ErrCertificateMismatch
+	}
+	g.CertThumbprint = params.CertThumbprint
+
+	// Заблокированный или удаленный пользователь не может продлевать сессию
+	user, err := as.checkUser(context.Background(), tokenData.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotAllowed) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+		}
+		return nil, err
 	}
 
-	// Проверка IP адреса
-	if tokenData.ClientIP != clientIP {
-		fmt.Printf("Client IP mismatch: expected %s, got %s\n", tokenData.ClientIP, clientIP)
-		return nil, fmt.Errorf("invalid client IP")
+	// Scope сессии можно сузить, но не расширить, а роли берутся актуальные
+	if g.Scope, err = as.refreshScope(params.Scope, tokenData.Scope, user, client); err != nil {
+		return nil, err
+	}
+	if user != nil {
+		g.Roles = user.Roles
+	}
+
+	// Проверка таймаута бездействия и абсолютного предела сессии
+	if err := as.checkSession(tokenData, time.Now()); err != nil {
+		return nil, err
 	}
 
-	// Создание новой пары токенов
-	newTokens, err := as.CreateTokenPair(context.Background(), tokenData.UserID, clientIP)
+	// Проверка устройства: смена IP, User-Agent, отпечатка и device_id взвешивается политикой привязки
+	binding := as.policy.bindingPolicy()
+	score, changes := binding.bindingScore(tokenData, current)
+	if len(changes) > 0 {
+		fmt.Printf("Client device changed (%s), score %d\n", strings.Join(changes, ", "), score)
+	}
+	ipOnly := len(changes) == 1 && changes[0] == bindingChangeIP
+	if binding.RejectThreshold > 0 && score >= binding.RejectThreshold {
+		if ipOnly {
+			return nil, ErrClientIPMismatch
+		}
+		as.recordDeviceChange(tokenData, current, changes, "rejected")
+		return nil, ErrDeviceMismatch
+	}
+	warn := binding.WarnThreshold > 0 && score >= binding.WarnThreshold
+
+	// Ротация в одной транзакции: старый токен помечается использованным условным UPDATE,
+	// который блокирует строку, и только победитель вставляет преемника
+	var newTokens *models.AccessTokenRefreshToken
+	err = as.tokenRepository.WithinTransaction(context.Background(), func(tx repository.TokenRepository) error {
+		consumed, err := tx.ConsumeRefreshToken(context.Background(), tokenData.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update refresh token: %v", err)
+		}
+		if !consumed {
+			// Параллельный запрос с тем же токеном успел раньше
+			return ErrRefreshTokenUsed
+		}
+
+		// Создание новой пары токенов в рамках той же сессии
+		newTokens, err = as.issueTokenPair(context.Background(), tx, g, tokenData)
+		if err != nil {
+			return fmt.Errorf("failed to create new token pair: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("Error creating new token pair: %v\n", err)
-		return nil, fmt.Errorf("failed to create new token pair: %v", err)
+		fmt.Printf("Error rotating refresh token: %v\n", err)
+		return nil, err
 	}
 
-	// Отметка старого токена как использованного
-	tokenData.Used = true
-	if err := as.tokenRepository.UpdateRefreshToken(context.Background(), tokenData); err != nil {
-		fmt.Printf("Error updating refresh token in DB: %v\n", err)
-		return nil, fmt.Errorf("failed to update refresh token: %v", err)
+	// Письмо отправляется только после успешной ротации
+	if warn {
+		if !ipOnly {
+			as.recordDeviceChange(tokenData, current, changes, "allowed with warning")
+		}
+		as.warnIPChange(tokenData, clientIP, params.UserAgent, !ipOnly)
 	}
 
 	return newTokens, nil
 }
+
+// checkSession проверяет, что сессия строки refresh_tokens еще жива: срок самого токена,
+// таймаут бездействия и абсолютный предел сессии с момента входа
+func (as *AuthService) checkSession(tokenData *models.RefreshTokenData, now time.Time) error {
+	if !now.Before(tokenData.ExpiresAt) {
+		fmt.Printf("Refresh token expired\n")
+		return ErrSessionExpired
+	}
+
+	if as.policy.IdleTimeout > 0 && now.After(tokenData.CreatedAt.Add(as.policy.IdleTimeout)) {
+		fmt.Printf("Refresh token idle timeout exceeded\n")
+		return ErrSessionExpired
+	}
+
+	if deadline, ok := as.policy.sessionDeadline(tokenData.SessionStartedAt); ok && now.After(deadline) {
+		fmt.Printf("Session lifetime exceeded\n")
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+// checkTokenPair проверяет, что access token подписан нами и выдан в паре с tokenData.
+// Срок действия access token не проверяется, т.к. обычно refresh делают как раз после его истечения.
+func (as *AuthService) checkTokenPair(accessToken string, tokenData *models.RefreshTokenData) error {
+	if accessToken == "" {
+		fmt.Printf("Access token for pairing check is missing\n")
+		return ErrTokenPairMismatch
+	}
+
+	claims, err := as.parseAccessToken(accessToken, false)
+	if err != nil {
+		return ErrTokenPairMismatch
+	}
+
+	if claims.TokenID.String() != tokenData.AccessTokenID || claims.UserID != tokenData.UserID {
+		fmt.Printf("Token pair mismatch: access token %s, expected %s\n", claims.TokenID, tokenData.AccessTokenID)
+		return ErrTokenPairMismatch
+	}
+
+	return nil
+}
+
+// checkRefreshClient проверяет, что refresh token предъявил клиент, которому он был выдан
+func (as *AuthService) checkRefreshClient(ctx context.Context, tokenData *models.RefreshTokenData, clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID != tokenData.ClientID {
+		fmt.Printf("Refresh token issued to client %s presented by %q\n", tokenData.ClientID, clientID)
+		return nil, ErrClientMismatch
+	}
+
+	client, err := as.identifyClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(models.GrantTypeRefreshToken) {
+		return nil, ErrUnauthorizedClient
+	}
+	return client, nil
+}
+
+// revokeFamily отзывает все токены семейства после обнаружения повторного использования,
+// гасит их access токены и записывает событие безопасности
+func (as *AuthService) revokeFamily(ctx context.Context, reused *models.RefreshTokenData, clientIP string) error {
+	revoked, err := as.tokenRepository.RevokeFamily(ctx, reused.FamilyID, models.RevokeReasonReuse)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family: %v", err)
+	}
+
+	for _, tokenData := range revoked {
+		if err := as.denyAccessToken(ctx, tokenData); err != nil {
+			return err
+		}
+	}
+
+	as.recordSecurityEvent(ctx, &models.SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    reused.UserID,
+		Type:      models.SecurityEventTokenReuse,
+		FamilyID:  reused.FamilyID,
+		ClientIP:  clientIP,
+		Details:   fmt.Sprintf("reused refresh token %s, revoked %d tokens", reused.ID, len(revoked)),
+		CreatedAt: time.Now(),
+	})
+
+	return nil
+}
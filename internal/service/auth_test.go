@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// fakeTokenRepository - TokenRepository в памяти для тестов.
+// ConsumeRefreshToken, как и условный UPDATE в Postgres, атомарно меняет used с false на true.
+type fakeTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]*models.RefreshTokenData
+}
+
+func newFakeTokenRepository() *fakeTokenRepository {
+	return &fakeTokenRepository{tokens: make(map[uuid.UUID]*models.RefreshTokenData)}
+}
+
+func (r *fakeTokenRepository) SaveRefreshToken(ctx context.Context, token *models.RefreshTokenData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *token
+	r.tokens[token.ID] = &stored
+	return nil
+}
+
+func (r *fakeTokenRepository) GetRefreshToken(ctx context.Context, selector, verifier string) (*models.RefreshTokenData, error) {
+	r.mu.Lock()
+	var found *models.RefreshTokenData
+	for _, token := range r.tokens {
+		if token.Selector == selector && token.ExpiresAt.After(time.Now()) {
+			copied := *token
+			found = &copied
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	// bcrypt сравнивается без блокировки, как и в Postgres параллельные чтения не ждут друг друга
+	if found == nil || bcrypt.CompareHashAndPassword([]byte(found.TokenHash), []byte(verifier)) != nil {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	return found, nil
+}
+
+func (r *fakeTokenRepository) GetRefreshTokenByAccessTokenID(ctx context.Context, accessTokenID string) (*models.RefreshTokenData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.AccessTokenID == accessTokenID {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrRefreshTokenNotFound
+}
+
+func (r *fakeTokenRepository) RevokeRefreshToken(ctx context.Context, tokenID uuid.UUID, reason string) error {
+	r.revokeWhere(func(token *models.RefreshTokenData) bool { return token.ID == tokenID }, reason)
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, reason string) ([]*models.RefreshTokenData, error) {
+	return r.revokeWhere(func(token *models.RefreshTokenData) bool { return token.UserID == userID }, reason), nil
+}
+
+func (r *fakeTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID, reason string) ([]*models.RefreshTokenData, error) {
+	return r.revokeWhere(func(token *models.RefreshTokenData) bool { return token.FamilyID == familyID }, reason), nil
+}
+
+func (r *fakeTokenRepository) GetActiveRefreshTokens(ctx context.Context, userID uuid.UUID) ([]*models.RefreshTokenData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var active []*models.RefreshTokenData
+	for _, token := range r.tokens {
+		if token.UserID == userID && !token.Used && token.RevokedAt == nil {
+			copied := *token
+			active = append(active, &copied)
+		}
+	}
+	return active, nil
+}
+
+func (r *fakeTokenRepository) ConsumeRefreshToken(ctx context.Context, tokenID uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenID]
+	if !ok || token.Used || token.RevokedAt != nil {
+		return false, nil
+	}
+	token.Used = true
+	return true, nil
+}
+
+func (r *fakeTokenRepository) WithinTransaction(ctx context.Context, fn func(tx repository.TokenRepository) error) error {
+	return fn(r)
+}
+
+// revokeWhere отзывает еще не отозванные токены, подходящие под условие, и возвращает их
+func (r *fakeTokenRepository) revokeWhere(match func(token *models.RefreshTokenData) bool, reason string) []*models.RefreshTokenData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var revoked []*models.RefreshTokenData
+	for _, token := range r.tokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt, token.RevokedReason = &now, reason
+			copied := *token
+			revoked = append(revoked, &copied)
+		}
+	}
+	return revoked
+}
+
+// all возвращает копии всех сохраненных токенов
+func (r *fakeTokenRepository) all() []models.RefreshTokenData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens := make([]models.RefreshTokenData, 0, len(r.tokens))
+	for _, token := range r.tokens {
+		tokens = append(tokens, *token)
+	}
+	return tokens
+}
+
+// newTestAuthService создает AuthService с ключом HS256 и хранилищем repo
+func newTestAuthService(t *testing.T, repo repository.TokenRepository) *AuthService {
+	t.Helper()
+
+	signer, err := NewSigner("HS256", []byte("test-secret"), "")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	keyRing, err := NewKeyRing(time.Hour, &SigningKey{ID: "test", Signer: signer})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+
+	return NewAuthService(repo, keyRing, TokenPolicy{
+		Issuer:     "http://auth.test",
+		Audience:   []string{"http://auth.test"},
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 24 * time.Hour,
+	})
+}
+
+// refreshParams собирает запрос на обновление пары с того же устройства, которому она выдана
+func refreshParams(tokens *models.AccessTokenRefreshToken) RefreshParams {
+	return RefreshParams{
+		RefreshToken: tokens.RefreshToken,
+		AccessToken:  tokens.AccessToken,
+		ClientIP:     "10.0.0.1",
+	}
+}
+
+func TestRefreshTokenConcurrentRotation(t *testing.T) {
+	repo := newFakeTokenRepository()
+	as := newTestAuthService(t, repo)
+
+	tokens, err := as.CreateTokenPair(context.Background(), uuid.New(), "10.0.0.1", "")
+	if err != nil {
+		t.Fatalf("CreateTokenPair: %v", err)
+	}
+
+	const workers = 10
+	var (
+		wg      sync.WaitGroup
+		start   = make(chan struct{})
+		results = make([]*models.AccessTokenRefreshToken, workers)
+		errs    = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = as.RefreshToken(refreshParams(tokens))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// Новую пару получает ровно один запрос. Остальные проигрывают гонку за строку
+	// или, если пришли уже после ротации, считаются повторным использованием.
+	succeeded := 0
+	for i, err := range errs {
+		if err == nil {
+			if results[i] == nil || results[i].RefreshToken == tokens.RefreshToken {
+				t.Errorf("worker %d: expected a new token pair, got %+v", i, results[i])
+			}
+			succeeded++
+			continue
+		}
+		if !errors.Is(err, ErrRefreshTokenUsed) && !errors.Is(err, ErrTokenReused) {
+			t.Errorf("worker %d: unexpected error: %v", i, err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly one successful refresh, got %d", succeeded)
+	}
+
+	// Исходный токен и ровно один преемник
+	if stored := repo.all(); len(stored) != 2 {
+		t.Fatalf("expected 2 stored refresh tokens, got %d", len(stored))
+	}
+}
+
+func TestRefreshTokenReuseDetection(t *testing.T) {
+	tests := []struct {
+		name          string
+		prepare       func(t *testing.T, as *AuthService, repo *fakeTokenRepository, tokens *models.AccessTokenRefreshToken)
+		wantErr       error
+		familyRevoked bool // Все токены сессии отозваны с причиной token_reuse
+	}{
+		{
+			name:    "fresh token rotates",
+			wantErr: nil,
+		},
+		{
+			name: "used token revokes the whole family",
+			prepare: func(t *testing.T, as *AuthService, repo *fakeTokenRepository, tokens *models.AccessTokenRefreshToken) {
+				if _, err := as.RefreshToken(refreshParams(tokens)); err != nil {
+					t.Fatalf("first refresh: %v", err)
+				}
+			},
+			wantErr:       ErrTokenReused,
+			familyRevoked: true,
+		},
+		{
+			name: "revoked token is rejected without revoking the family",
+			prepare: func(t *testing.T, as *AuthService, repo *fakeTokenRepository, tokens *models.AccessTokenRefreshToken) {
+				for _, token := range repo.all() {
+					if err := repo.RevokeRefreshToken(context.Background(), token.ID, models.RevokeReasonClient); err != nil {
+						t.Fatalf("RevokeRefreshToken: %v", err)
+					}
+				}
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "unknown verifier is rejected",
+			prepare: func(t *testing.T, as *AuthService, repo *fakeTokenRepository, tokens *models.AccessTokenRefreshToken) {
+				b, _ := base64.StdEncoding.DecodeString(tokens.RefreshToken)
+				b[len(b)-1] ^= 0xff
+				tokens.RefreshToken = base64.StdEncoding.EncodeToString(b)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTokenRepository()
+			as := newTestAuthService(t, repo)
+
+			tokens, err := as.CreateTokenPair(context.Background(), uuid.New(), "10.0.0.1", "")
+			if err != nil {
+				t.Fatalf("CreateTokenPair: %v", err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, as, repo, tokens)
+			}
+
+			_, err = as.RefreshToken(refreshParams(tokens))
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, ErrInvalidGrant) {
+				t.Errorf("expected %v to be an invalid_grant error", err)
+			}
+
+			for _, token := range repo.all() {
+				revokedForReuse := token.RevokedAt != nil && token.RevokedReason == models.RevokeReasonReuse
+				if revokedForReuse != tt.familyRevoked {
+					t.Errorf("token %s: revoked for reuse = %v, want %v", token.ID, revokedForReuse, tt.familyRevoked)
+				}
+
+				// Access токены отозванного семейства перестают работать сразу
+				denied, err := as.denylist.Contains(context.Background(), token.AccessTokenID)
+				if err != nil {
+					t.Fatalf("denylist: %v", err)
+				}
+				if denied != tt.familyRevoked {
+					t.Errorf("access token %s: denied = %v, want %v", token.AccessTokenID, denied, tt.familyRevoked)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitRefreshToken(t *testing.T) {
+	selectorBytes := []byte(strings.Repeat("\x01", refreshSelectorSize))
+	verifierBytes := []byte(strings.Repeat("\x02", refreshVerifierSize))
+	legacy := base64.StdEncoding.EncodeToString(verifierBytes)
+
+	tests := []struct {
+		name         string
+		token        string
+		wantSelector string
+		wantVerifier string
+	}{
+		{
+			name:         "selector and verifier",
+			token:        base64.StdEncoding.EncodeToString(append(selectorBytes, verifierBytes...)),
+			wantSelector: hex.EncodeToString(selectorBytes),
+			wantVerifier: base64.StdEncoding.EncodeToString(verifierBytes),
+		},
+		{
+			name:         "legacy token without selector",
+			token:        legacy,
+			wantSelector: "",
+			wantVerifier: legacy,
+		},
+		{
+			name:         "not base64",
+			token:        "not a token!",
+			wantSelector: "",
+			wantVerifier: "not a token!",
+		},
+		{
+			name:         "wrong length",
+			token:        base64.StdEncoding.EncodeToString(append(selectorBytes, 0x03)),
+			wantSelector: "",
+			wantVerifier: base64.StdEncoding.EncodeToString(append(selectorBytes, 0x03)),
+		},
+		{
+			name:         "empty",
+			token:        "",
+			wantSelector: "",
+			wantVerifier: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, verifier := splitRefreshToken(tt.token)
+			if selector != tt.wantSelector || verifier != tt.wantVerifier {
+				t.Errorf("splitRefreshToken(%q) = (%q, %q), want (%q, %q)",
+					tt.token, selector, verifier, tt.wantSelector, tt.wantVerifier)
+			}
+		})
+	}
+}
+
+func TestGenerateRefreshTokenSplits(t *testing.T) {
+	token, selector, verifier, err := (&AuthService{}).generateRefreshToken()
+	if err != nil {
+		t.Fatalf("generateRefreshToken: %v", err)
+	}
+
+	gotSelector, gotVerifier := splitRefreshToken(token)
+	if gotSelector != selector || gotVerifier != verifier {
+		t.Errorf("splitRefreshToken does not match generated parts: (%q, %q) vs (%q, %q)", gotSelector, gotVerifier, selector, verifier)
+	}
+	if len(selector) != 2*refreshSelectorSize {
+		t.Errorf("selector length = %d, want %d", len(selector), 2*refreshSelectorSize)
+	}
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Единственный поддерживаемый метод PKCE, plain не защищает от перехвата кода
+const pkceMethodS256 = "S256"
+
+// Допустимый вид code_verifier и code_challenge (RFC 7636, раздел 4.1)
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// AuthorizeRequest - параметры запроса авторизации (RFC 6749, раздел 4.1.1 и RFC 7636, раздел 4.3)
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	State               string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizeParams - запрос авторизации вместе с тем, что пользователь ввел на странице входа
+type AuthorizeParams struct {
+	AuthorizeRequest
+	Login    string // Username или email, на первом шаге
+	Password string
+	MFAToken string // Токен после пароля, на втором шаге для пользователей с TOTP
+	Code     string // Код из приложения-аутентификатора
+	ClientIP string
+}
+
+// AuthorizeResult - результат входа на странице авторизации: код или требование второго фактора
+type AuthorizeResult struct {
+	Code     string
+	MFAToken string
+}
+
+// CodeExchangeParams - параметры grant_type=authorization_code (RFC 6749, раздел 4.1.3)
+type CodeExchangeParams struct {
+	Code           string
+	RedirectURI    string
+	ClientID       string
+	ClientSecret   string // Только у конфиденциальных клиентов
+	CodeVerifier   string
+	ClientIP       string
+	UserAgent      string
+	DeviceID       string
+	AcceptLanguage string
+	DPoP           DPoPProof // Proof из заголовка DPoP, пусто - bearer токены
+	CertThumbprint string    // Отпечаток клиентского сертификата mTLS, пусто - клиент без сертификата
+}
+
+// WithAuthorizationCodes включает authorization_code grant
+func WithAuthorizationCodes(codes repository.AuthorizationCodeRepository) Option {
+	return func(as *AuthService) {
+		as.codes = codes
+	}
+}
+
+// ValidateAuthorizeRequest проверяет клиента, redirect_uri и PKCE до показа страницы входа.
+// ErrInvalidClient и ErrInvalidRedirectURI нельзя отправлять на redirect_uri, остальные ошибки можно.
+func (as *AuthService) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (*models.OAuthClient, error) {
+	if as.clientRegistry == nil || as.codes == nil {
+		return nil, fmt.Errorf("authorization code flow is not configured")
+	}
+
+	client, err := as.clientRegistry.GetClient(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %v", err)
+	}
+
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		fmt.Printf("Client %s used unregistered redirect_uri %s\n", client.ClientID, req.RedirectURI)
+		return nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return client, ErrUnsupportedResponseType
+	}
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		return client, ErrUnauthorizedClient
+	}
+	if req.CodeChallengeMethod != pkceMethodS256 || !pkceValuePattern.MatchString(req.CodeChallenge) {
+		return client, ErrPKCERequired
+	}
+	if _, err := grantedScope(client, req.Scope); err != nil {
+		return client, err
+	}
+
+	return client, nil
+}
+
+// Authorize проверяет пользователя на странице входа и выдает authorization code.
+// Пользователю с TOTP сначала возвращается mfa_token, код выдается после второго шага.
+func (as *AuthService) Authorize(ctx context.Context, params AuthorizeParams) (*AuthorizeResult, error) {
+	client, err := as.ValidateAuthorizeRequest(ctx, params.AuthorizeRequest)
+	if err != nil {
+		return nil, err
+	}
+	if as.credentials == nil {
+		return nil, fmt.Errorf("password login is not configured")
+	}
+
+	var g grant
+	if params.MFAToken != "" {
+		// Второй шаг: пароль уже проверен, остался код
+		claims, userID, err := as.parseMFAToken(params.MFAToken)
+		if err != nil {
+			return nil, err
+		}
+		amr, err := as.verifySecondFactor(ctx, userID, params.Code, "")
+		if errors.Is(err, ErrMFANotEnrolled) {
+			return nil, ErrInvalidMFAToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := as.useMFAToken(ctx, claims); err != nil {
+			return nil, err
+		}
+		g = grant{UserID: userID, AMR: amr, ACR: models.ACRMultiFactor}
+	} else {
+		credentials, err := as.authenticatePassword(ctx, params.Login, params.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		enrolled, err := as.totpEnrolled(ctx, credentials.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if enrolled {
+			mfaToken, _, err := as.issueMFAToken(credentials.UserID, params.Scope)
+			if err != nil {
+				return nil, fmt.Errorf("failed to issue mfa token: %v", err)
+			}
+			return &AuthorizeResult{MFAToken: mfaToken}, nil
+		}
+		g = grant{UserID: credentials.UserID, AMR: []string{models.AMRPassword}, ACR: models.ACRSingleFactor}
+	}
+
+	// Scope запроса уже проверены по клиенту, теперь по пользователю
+	user, err := as.checkUser(ctx, g.UserID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := as.sessionScope(params.Scope, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сам код отдается клиенту, в БД только его хэш
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate authorization code: %v", err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	err = as.codes.SaveAuthorizationCode(ctx, &models.AuthorizationCode{
+		CodeHash:      hashAuthorizationCode(code),
+		ClientID:      client.ClientID,
+		UserID:        g.UserID,
+		RedirectURI:   params.RedirectURI,
+		CodeChallenge: params.CodeChallenge,
+		Scope:         scope,
+		AMR:           g.AMR,
+		ACR:           g.ACR,
+		FamilyID:      uuid.New(),
+		ExpiresAt:     now.Add(as.policy.AuthorizationCodeTTL),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save authorization code: %v", err)
+	}
+
+	fmt.Printf("Issued authorization code for user %s and client %s\n", g.UserID, client.ClientID)
+	return &AuthorizeResult{Code: code}, nil
+}
+
+// ExchangeAuthorizationCode обменивает authorization code на пару токенов, как у CreateTokenPair.
+// Код одноразовый и привязан к клиенту, redirect_uri и PKCE challenge.
+func (as *AuthService) ExchangeAuthorizationCode(ctx context.Context, params CodeExchangeParams) (*models.AccessTokenRefreshToken, error) {
+	if as.codes == nil {
+		return nil, fmt.Errorf("authorization code flow is not configured")
+	}
+
+	client, err := as.identifyClient(ctx, params.ClientID, params.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		return nil, ErrUnauthorizedClient
+	}
+
+	// Proof проверяется до погашения кода: после ответа use_dpop_nonce клиент повторит обмен с тем же кодом
+	jkt, err := as.checkDPoPProof(ctx, params.DPoP)
+	if err != nil {
+		return nil, err
+	}
+
+	// Код гасится до остальных проверок: неудачная попытка тоже его сжигает
+	code, err := as.codes.ConsumeAuthorizationCode(ctx, hashAuthorizationCode(params.Code))
+	if errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+		return nil, ErrInvalidCode
+	}
+	if errors.Is(err, repository.ErrAuthorizationCodeUsed) {
+		if err := as.revokeCodeFamily(ctx, code, params.ClientIP); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume authorization code: %v", err)
+	}
+
+	if code.ClientID != client.ClientID {
+		fmt.Printf("Authorization code issued to %s presented by %s\n", code.ClientID, client.ClientID)
+		return nil, ErrInvalidCode
+	}
+	if code.RedirectURI != params.RedirectURI {
+		fmt.Printf("Authorization code redirect_uri mismatch\n")
+		return nil, ErrInvalidCode
+	}
+	if time.Now().After(code.ExpiresAt) {
+		fmt.Printf("Authorization code expired\n")
+		return nil, ErrInvalidCode
+	}
+	if !verifyPKCE(params.CodeVerifier, code.CodeChallenge) {
+		return nil, ErrInvalidCodeVerifier
+	}
+
+	device := newDevice(params.ClientIP, params.UserAgent, params.DeviceID, params.AcceptLanguage)
+	return as.startSession(ctx, as.clientGrant(grant{
+		UserID:         code.UserID,
+		ClientIP:       params.ClientIP,
+		UserAgent:      params.UserAgent,
+		DeviceID:       device.DeviceID,
+		Fingerprint:    device.Fingerprint,
+		AMR:            code.AMR,
+		ACR:            code.ACR,
+		Scope:          code.Scope,
+		DPoPJKT:        jkt,
+		CertThumbprint: params.CertThumbprint,
+		FamilyID:       code.FamilyID,
+	}, client))
+}
+
+// revokeCodeFamily отзывает токены, выданные по повторно предъявленному коду (RFC 6749, раздел 4.1.2):
+// код мог быть перехвачен, и непонятно, кто из предъявивших его легитимный клиент
+func (as *AuthService) revokeCodeFamily(ctx context.Context, code *models.AuthorizationCode, clientIP string) error {
+	// У кодов, выданных до появления family_id, семейство неизвестно
+	revoked := []*models.RefreshTokenData{}
+	if code.FamilyID != uuid.Nil {
+		var err error
+		revoked, err = as.tokenRepository.RevokeFamily(ctx, code.FamilyID, models.RevokeReasonReuse)
+		if err != nil {
+			return fmt.Errorf("failed to revoke token family: %v", err)
+		}
+	}
+
+	for _, tokenData := range revoked {
+		if err := as.denyAccessToken(ctx, tokenData); err != nil {
+			return err
+		}
+	}
+
+	as.recordSecurityEvent(ctx, &models.SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    code.UserID,
+		Type:      models.SecurityEventCodeReuse,
+		FamilyID:  code.FamilyID,
+		ClientIP:  clientIP,
+		Details:   fmt.Sprintf("authorization code for client %s presented again, revoked %d tokens", code.ClientID, len(revoked)),
+		CreatedAt: time.Now(),
+	})
+
+	return nil
+}
+
+// identifyClient находит клиента из реестра на token endpoint.
+// Конфиденциальный клиент обязан предъявить секрет, публичному достаточно client_id - его защищает PKCE.
+func (as *AuthService) identifyClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	if as.clientRegistry == nil || clientID == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := as.clientRegistry.GetClient(ctx, clientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %v", err)
+	}
+
+	if !client.Public() {
+		if err := checkClientSecret(client, clientSecret); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// verifyPKCE сверяет code_verifier с сохраненным S256 challenge
+func verifyPKCE(verifier, challenge string) bool {
+	if !pkceValuePattern.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// hashAuthorizationCode возвращает SHA-256 хэш кода для поиска в БД.
+// Как и у кодов восстановления, в коде достаточно случайных бит, чтобы не нужен был медленный хэш.
+func hashAuthorizationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// fakeCodeRepository - AuthorizationCodeRepository в памяти, погашение кода атомарно, как UPDATE ... RETURNING
+type fakeCodeRepository struct {
+	mu    sync.Mutex
+	codes map[string]*models.AuthorizationCode
+}
+
+func (r *fakeCodeRepository) SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *code
+	r.codes[code.CodeHash] = &stored
+	return nil
+}
+
+func (r *fakeCodeRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.codes[codeHash]
+	if !ok {
+		return nil, repository.ErrAuthorizationCodeNotFound
+	}
+	stored := *code
+	if code.UsedAt != nil {
+		return &stored, repository.ErrAuthorizationCodeUsed
+	}
+	now := time.Now()
+	code.UsedAt = &now
+	return &stored, nil
+}
+
+// fakeClientRegistry - реестр OAuth клиентов в памяти
+type fakeClientRegistry map[string]*models.OAuthClient
+
+func (r fakeClientRegistry) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	client, ok := r[clientID]
+	if !ok {
+		return nil, repository.ErrClientNotFound
+	}
+	return client, nil
+}
+
+func TestExchangeAuthorizationCodeReuse(t *testing.T) {
+	// Пример из RFC 7636, приложение B
+	const (
+		code      = "authorization-code"
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+		redirect  = "http://localhost:3000/callback"
+	)
+
+	repo := newFakeTokenRepository()
+	codes := &fakeCodeRepository{codes: make(map[string]*models.AuthorizationCode)}
+	as := newTestAuthService(t, repo)
+	WithAuthorizationCodes(codes)(as)
+	WithClientRegistry(fakeClientRegistry{"web-app": {
+		ClientID:     "web-app",
+		GrantTypes:   []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken},
+		RedirectURIs: []string{redirect},
+	}})(as)
+
+	familyID := uuid.New()
+	err := codes.SaveAuthorizationCode(context.Background(), &models.AuthorizationCode{
+		CodeHash:      hashAuthorizationCode(code),
+		ClientID:      "web-app",
+		UserID:        uuid.New(),
+		RedirectURI:   redirect,
+		CodeChallenge: challenge,
+		AMR:           []string{models.AMRPassword},
+		ACR:           models.ACRSingleFactor,
+		FamilyID:      familyID,
+		ExpiresAt:     time.Now().Add(time.Minute),
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("SaveAuthorizationCode: %v", err)
+	}
+
+	params := CodeExchangeParams{Code: code, RedirectURI: redirect, ClientID: "web-app", CodeVerifier: verifier, ClientIP: "10.0.0.1"}
+	tokens, err := as.ExchangeAuthorizationCode(context.Background(), params)
+	if err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+
+	// Сессия из кода продолжает семейство, заранее записанное в код
+	rotated, err := as.RefreshToken(RefreshParams{RefreshToken: tokens.RefreshToken, AccessToken: tokens.AccessToken, ClientIP: "10.0.0.1", ClientID: "web-app"})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	for _, tokenData := range repo.all() {
+		if tokenData.FamilyID != familyID {
+			t.Fatalf("token %s has family %s, want %s", tokenData.ID, tokenData.FamilyID, familyID)
+		}
+	}
+
+	// Повторное предъявление кода отзывает все семейство, включая токены после ротации
+	if _, err := as.ExchangeAuthorizationCode(context.Background(), params); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("second exchange: expected ErrInvalidCode, got %v", err)
+	}
+	for _, tokenData := range repo.all() {
+		if tokenData.RevokedAt == nil || tokenData.RevokedReason != models.RevokeReasonReuse {
+			t.Errorf("token %s is not revoked for reuse", tokenData.ID)
+		}
+	}
+	if _, err := as.RefreshToken(RefreshParams{RefreshToken: rotated.RefreshToken, AccessToken: rotated.AccessToken, ClientIP: "10.0.0.1", ClientID: "web-app"}); err == nil {
+		t.Fatal("refresh after code reuse succeeded")
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// Пример из RFC 7636, приложение B
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"rfc 7636 example", verifier, challenge, true},
+		{"wrong verifier", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXj", challenge, false},
+		{"wrong challenge", verifier, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cN", false},
+		{"plain challenge is not accepted", verifier, verifier, false},
+		{"verifier too short", verifier[:42], challenge, false},
+		{"verifier too long", strings.Repeat("a", 129), challenge, false},
+		{"verifier with forbidden characters", "dBjftJeZ4CVP+mB92K27uhbUJU1p1r/wW1gFWFOEjXk", challenge, false},
+		{"empty verifier", "", challenge, false},
+		{"empty challenge", verifier, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
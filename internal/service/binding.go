@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"juniortest/internal/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Максимальная длина device_id, более длинные значения обрезаются
+const maxDeviceIDLength = 128
+
+// Что изменилось в устройстве клиента между выдачей refresh token и его предъявлением
+const (
+	bindingChangeIP          = "ip"
+	bindingChangeUserAgent   = "user_agent"
+	bindingChangeFingerprint = "fingerprint"
+	bindingChangeDevice      = "device_id"
+)
+
+// BindingPolicy - насколько refresh token привязан к устройству.
+// Каждое изменение с прошлого обновления добавляет свой вес, сумма сравнивается с порогами.
+// Например, при весах IP 1 и device_id 10 и пороге отказа 10 смена IP у мобильных клиентов за CGNAT
+// допускается, а предъявление токена с другого устройства - нет.
+type BindingPolicy struct {
+	IPWeight          int // Смена IP адреса
+	UserAgentWeight   int // Смена User-Agent, например после обновления браузера
+	FingerprintWeight int // Смена грубого отпечатка: семейство браузера, ОС и основной язык
+	DeviceWeight      int // Смена или пропажа device_id, который клиент присылал раньше
+	WarnThreshold     int // С этой суммы пользователю отправляется письмо, 0 - не отправлять
+	RejectThreshold   int // С этой суммы refresh отклоняется, 0 - не отклонять
+}
+
+// ipBindingPolicy выражает IPChangePolicy через веса: учитывается только смена IP
+func ipBindingPolicy(policy IPChangePolicy) BindingPolicy {
+	switch policy {
+	case IPChangeAllow:
+		return BindingPolicy{}
+	case IPChangeWarn:
+		return BindingPolicy{IPWeight: 1, WarnThreshold: 1}
+	default:
+		return BindingPolicy{IPWeight: 1, RejectThreshold: 1}
+	}
+}
+
+// bindingPolicy возвращает действующую политику: заданные веса или, если их нет, IPChangePolicy
+func (p TokenPolicy) bindingPolicy() BindingPolicy {
+	if p.Binding == (BindingPolicy{}) {
+		return ipBindingPolicy(p.IPChangePolicy)
+	}
+	return p.Binding
+}
+
+// device - сведения об устройстве клиента, сохраняются в строке refresh_tokens
+type device struct {
+	IP          string
+	UserAgent   string
+	DeviceID    string
+	Fingerprint string
+}
+
+// newDevice собирает сведения об устройстве из запроса
+func newDevice(clientIP, userAgent, deviceID, acceptLanguage string) device {
+	deviceID = strings.TrimSpace(deviceID)
+	if len(deviceID) > maxDeviceIDLength {
+		deviceID = deviceID[:maxDeviceIDLength]
+	}
+	return device{
+		IP:          clientIP,
+		UserAgent:   userAgent,
+		DeviceID:    deviceID,
+		Fingerprint: deviceFingerprint(userAgent, acceptLanguage),
+	}
+}
+
+// bindingScore сравнивает устройство с тем, которому был выдан токен, и возвращает сумму весов и список изменений.
+// Признаки, которых не было при выдаче (токены до появления колонок, клиент без device_id), не учитываются.
+func (p BindingPolicy) bindingScore(tokenData *models.RefreshTokenData, current device) (int, []string) {
+	score := 0
+	var changes []string
+	add := func(change string, weight int) {
+		score += weight
+		changes = append(changes, change)
+	}
+
+	if tokenData.ClientIP != current.IP {
+		add(bindingChangeIP, p.IPWeight)
+	}
+	if tokenData.UserAgent != "" && tokenData.UserAgent != current.UserAgent {
+		add(bindingChangeUserAgent, p.UserAgentWeight)
+	}
+	if tokenData.DeviceFingerprint != "" && tokenData.DeviceFingerprint != current.Fingerprint {
+		add(bindingChangeFingerprint, p.FingerprintWeight)
+	}
+	if tokenData.DeviceID != "" && tokenData.DeviceID != current.DeviceID {
+		add(bindingChangeDevice, p.DeviceWeight)
+	}
+	return score, changes
+}
+
+// deviceFingerprint считает грубый отпечаток устройства: семейство браузера, ОС и основной язык без версий.
+// Он не меняется при обновлении браузера, но меняется при переходе на другое устройство или программу.
+func deviceFingerprint(userAgent, acceptLanguage string) string {
+	if userAgent == "" && acceptLanguage == "" {
+		return ""
+	}
+
+	language, _, _ := strings.Cut(acceptLanguage, ",")
+	language, _, _ = strings.Cut(language, ";")
+	language, _, _ = strings.Cut(strings.TrimSpace(language), "-")
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", browserFamily(userAgent), osFamily(userAgent), strings.ToLower(language))))
+	return hex.EncodeToString(sum[:16])
+}
+
+// browserFamily определяет семейство браузера по User-Agent, для остальных клиентов берется первый продукт без версии
+func browserFamily(userAgent string) string {
+	// Порядок важен: Edge и Opera содержат Chrome, а Chrome содержит Safari
+	for _, family := range []struct{ token, name string }{
+		{"Edg/", "edge"},
+		{"OPR/", "opera"},
+		{"Firefox/", "firefox"},
+		{"Chrome/", "chrome"},
+		{"Safari/", "safari"},
+	} {
+		if strings.Contains(userAgent, family.token) {
+			return family.name
+		}
+	}
+
+	product, _, _ := strings.Cut(userAgent, " ")
+	product, _, _ = strings.Cut(product, "/")
+	return strings.ToLower(product)
+}
+
+// osFamily определяет семейство ОС по User-Agent
+func osFamily(userAgent string) string {
+	for _, family := range []struct{ token, name string }{
+		{"Android", "android"},
+		{"iPhone", "ios"},
+		{"iPad", "ios"},
+		{"Windows", "windows"},
+		{"Mac OS X", "macos"},
+		{"CrOS", "chromeos"},
+		{"Linux", "linux"},
+	} {
+		if strings.Contains(userAgent, family.token) {
+			return family.name
+		}
+	}
+	return ""
+}
+
+// recordDeviceChange записывает событие безопасности о смене устройства, одна смена IP событием не считается
+func (as *AuthService) recordDeviceChange(tokenData *models.RefreshTokenData, current device, changes []string, outcome string) {
+	as.recordSecurityEvent(context.Background(), &models.SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    tokenData.UserID,
+		Type:      models.SecurityEventDeviceSwap,
+		FamilyID:  tokenData.FamilyID,
+		ClientIP:  current.IP,
+		Details:   fmt.Sprintf("refresh from changed device (%s), %s", strings.Join(changes, ", "), outcome),
+		CreatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"juniortest/internal/models"
+	"slices"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+func TestBindingScore(t *testing.T) {
+	policy := BindingPolicy{IPWeight: 1, UserAgentWeight: 2, FingerprintWeight: 4, DeviceWeight: 10}
+
+	issued := &models.RefreshTokenData{
+		ClientIP:          "10.0.0.1",
+		UserAgent:         "Mozilla/5.0 Firefox/120.0",
+		DeviceFingerprint: "fp-1",
+		DeviceID:          "device-1",
+	}
+	same := device{IP: "10.0.0.1", UserAgent: "Mozilla/5.0 Firefox/120.0", Fingerprint: "fp-1", DeviceID: "device-1"}
+
+	tests := []struct {
+		name        string
+		tokenData   *models.RefreshTokenData
+		current     func(d device) device
+		wantScore   int
+		wantChanges []string
+	}{
+		{
+			name:      "same device",
+			tokenData: issued,
+			current:   func(d device) device { return d },
+		},
+		{
+			name:        "ip changed",
+			tokenData:   issued,
+			current:     func(d device) device { d.IP = "10.0.0.2"; return d },
+			wantScore:   1,
+			wantChanges: []string{bindingChangeIP},
+		},
+		{
+			name:        "browser updated",
+			tokenData:   issued,
+			current:     func(d device) device { d.UserAgent = "Mozilla/5.0 Firefox/121.0"; return d },
+			wantScore:   2,
+			wantChanges: []string{bindingChangeUserAgent},
+		},
+		{
+			name:        "device id dropped",
+			tokenData:   issued,
+			current:     func(d device) device { d.DeviceID = ""; return d },
+			wantScore:   10,
+			wantChanges: []string{bindingChangeDevice},
+		},
+		{
+			name:      "everything changed",
+			tokenData: issued,
+			current: func(d device) device {
+				return device{IP: "10.0.0.2", UserAgent: "curl/8.0", Fingerprint: "fp-2", DeviceID: "device-2"}
+			},
+			wantScore:   17,
+			wantChanges: []string{bindingChangeIP, bindingChangeUserAgent, bindingChangeFingerprint, bindingChangeDevice},
+		},
+		{
+			// Токен выдан до появления колонок устройства: учитывается только IP
+			name:      "legacy token without device data",
+			tokenData: &models.RefreshTokenData{ClientIP: "10.0.0.1"},
+			current: func(d device) device {
+				return device{IP: "10.0.0.1", UserAgent: "curl/8.0", Fingerprint: "fp-2", DeviceID: "device-2"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, changes := policy.bindingScore(tt.tokenData, tt.current(same))
+			if score != tt.wantScore || !slices.Equal(changes, tt.wantChanges) {
+				t.Errorf("bindingScore = (%d, %v), want (%d, %v)", score, changes, tt.wantScore, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestIPBindingPolicy(t *testing.T) {
+	ipChanged := &models.RefreshTokenData{ClientIP: "10.0.0.1"}
+	current := device{IP: "10.0.0.2"}
+
+	tests := []struct {
+		policy     IPChangePolicy
+		wantWarn   bool
+		wantReject bool
+	}{
+		{IPChangeAllow, false, false},
+		{IPChangeWarn, true, false},
+		{IPChangeReject, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			binding := TokenPolicy{IPChangePolicy: tt.policy}.bindingPolicy()
+			score, _ := binding.bindingScore(ipChanged, current)
+
+			warn := binding.WarnThreshold > 0 && score >= binding.WarnThreshold
+			reject := binding.RejectThreshold > 0 && score >= binding.RejectThreshold
+			if warn != tt.wantWarn || reject != tt.wantReject {
+				t.Errorf("warn = %v, reject = %v, want %v, %v", warn, reject, tt.wantWarn, tt.wantReject)
+			}
+		})
+	}
+}
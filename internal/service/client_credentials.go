@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/pkg/jose"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// ClientCredentialsParams - входные данные операции ClientCredentials
+type ClientCredentialsParams struct {
+	ClientID       string
+	ClientSecret   string
+	Scope          string    // Запрошенные scope, пусто - все разрешенные клиенту
+	DPoP           DPoPProof // Proof из заголовка DPoP, пусто - клиент не использует DPoP
+	CertThumbprint string    // Отпечаток клиентского сертификата mTLS, пусто - клиент без сертификата
+}
+
+// ClientCredentials выдает access token самому клиенту из реестра (RFC 6749, раздел 4.4).
+// Refresh token не выдается: у клиента есть свои учетные данные, и он просто запросит новый токен.
+// С DPoP proof или клиентским сертификатом токен привязывается к ключу или сертификату клиента.
+func (as *AuthService) ClientCredentials(ctx context.Context, params ClientCredentialsParams) (*models.AccessTokenResponse, error) {
+	client, err := as.authenticateRegisteredClient(ctx, params.ClientID, params.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(models.GrantTypeClientCredentials) {
+		fmt.Printf("Client %s is not allowed to use client_credentials\n", client.ClientID)
+		return nil, ErrUnauthorizedClient
+	}
+
+	granted, err := grantedScope(client, params.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	jkt, err := as.checkDPoPProof(ctx, params.DPoP)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(as.clientAccessTTL(client))
+
+	// У токена клиента нет пользователя: sub, client_id и azp указывают на самого клиента
+	tokenID := uuid.New()
+	claims := &jose.Claims{
+		TokenID:  tokenID,
+		ClientID: client.ClientID,
+		AZP:      client.ClientID,
+		Scope:    granted,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    as.policy.Issuer,
+			Subject:   client.ClientID,
+			Audience:  as.audience(client.Audiences),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        tokenID.String(),
+		},
+		Cnf: confirmation(jkt, params.CertThumbprint),
+	}
+
+	accessToken, err := as.signToken(claims, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %v", err)
+	}
+
+	fmt.Printf("Issued client_credentials token for client %s\n", client.ClientID)
+	return &models.AccessTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType(jkt),
+		ExpiresIn:   int64(expiresAt.Sub(now).Seconds()),
+		Scope:       granted,
+	}, nil
+}
+
+// clientAccessTTL возвращает время жизни access token клиента.
+// Переопределение может только сократить срок из конфига: на нем основаны хранение выведенных ключей и denylist.
+func (as *AuthService) clientAccessTTL(client *models.OAuthClient) time.Duration {
+	return clientTTL(client.ClientID, "access_token_ttl", client.AccessTokenTTL, as.policy.AccessTTL)
+}
+
+// clientRefreshTTL возвращает время жизни refresh token клиента.
+// Как и для access token, срок из конфига - верхний предел, который переопределение не может превысить.
+func (as *AuthService) clientRefreshTTL(client *models.OAuthClient) time.Duration {
+	return clientTTL(client.ClientID, "refresh_token_ttl", client.RefreshTokenTTL, as.policy.RefreshTTL)
+}
+
+// clientTTL применяет переопределение срока из реестра клиентов, не выходя за предел limit.
+// Слишком длинное значение - ошибка настройки клиента, поэтому оно урезается с записью в лог.
+func clientTTL(clientID, name string, override, limit time.Duration) time.Duration {
+	if override <= 0 {
+		return limit
+	}
+	if override > limit {
+		fmt.Printf("Client %s %s %s exceeds configured %s, clamping\n", clientID, name, override, limit)
+		return limit
+	}
+	return override
+}
+
+// grantedScope проверяет запрошенные scope по списку разрешенных клиенту.
+// Без параметра scope клиент получает все разрешенные ему scope.
+func grantedScope(client *models.OAuthClient, requested string) (string, error) {
+	for _, scope := range strings.Fields(requested) {
+		if !client.AllowsScope(scope) {
+			fmt.Printf("Client %s is not allowed to request scope %s\n", client.ClientID, scope)
+			return "", ErrInvalidScope
+		}
+	}
+	return narrowScope(requested, client.Scopes, client.Scopes)
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"juniortest/internal/models"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+func TestGrantedScope(t *testing.T) {
+	client := &models.OAuthClient{ClientID: "reports", Scopes: []string{"reports:read", "reports:write"}}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantErr   error
+	}{
+		{name: "no scope requested", requested: "", want: "reports:read reports:write"},
+		{name: "subset", requested: "reports:read", want: "reports:read"},
+		{name: "duplicates removed", requested: "reports:read reports:read", want: "reports:read"},
+		{name: "scope not registered for client", requested: "reports:read admin", wantErr: ErrInvalidScope},
+		{name: "prefix of registered scope", requested: "reports", wantErr: ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grantedScope(client, tt.requested)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("grantedScope error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("grantedScope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// ClientAuthenticator проверяет учетные данные клиента (client_id и client_secret)
+type ClientAuthenticator interface {
+	AuthenticateClient(ctx context.Context, clientID, clientSecret string) error
+}
+
+// Хэш-заглушка для неизвестных client_id, чтобы время ответа не выдавало существование клиента
+var dummyClientSecretHash = []byte("$2a$10$TqPbjIyEnJ/ydLCQYwqu6u7Vy2rQYVHYE8Gi1xQkbS109HnjrSrlK")
+
+// Реализация ClientAuthenticator со списком клиентов из конфига
+type staticClientAuthenticator struct {
+	secretHashes map[string]string // client_id -> bcrypt хэш client_secret
+}
+
+// NewStaticClientAuthenticator создает ClientAuthenticator по списку client_id и bcrypt хэшей секретов
+func NewStaticClientAuthenticator(secretHashes map[string]string) ClientAuthenticator {
+	return &staticClientAuthenticator{secretHashes: secretHashes}
+}
+
+// AuthenticateClient сверяет секрет клиента с хэшем, для неизвестного клиента тратит столько же времени
+func (a *staticClientAuthenticator) AuthenticateClient(ctx context.Context, clientID, clientSecret string) error {
+	hash, ok := a.secretHashes[clientID]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyClientSecretHash, []byte(clientSecret))
+		return ErrInvalidClient
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(clientSecret)); err != nil {
+		return ErrInvalidClient
+	}
+	return nil
+}
+
+// WithClientRegistry подключает реестр OAuth клиентов из БД.
+// Клиенты реестра получают токены на token endpoint, но служебные эндпоинты им недоступны.
+func WithClientRegistry(registry repository.ClientRepository) Option {
+	return func(as *AuthService) {
+		as.clientRegistry = registry
+	}
+}
+
+// AuthenticateClient проверяет учетные данные доверенного клиента для служебных эндпоинтов
+// (/introspect, завершение сессий любого пользователя). Доверенными считаются только клиенты
+// из настроенного ClientAuthenticator: клиенты реестра, например фоновые задачи или публичные
+// приложения, не должны видеть чужие токены и завершать чужие сессии.
+func (as *AuthService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) error {
+	if clientID == "" || clientSecret == "" {
+		return ErrInvalidClient
+	}
+	return as.clients.AuthenticateClient(ctx, clientID, clientSecret)
+}
+
+// authenticateRegisteredClient проверяет учетные данные и возвращает клиента из реестра
+func (as *AuthService) authenticateRegisteredClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	if as.clientRegistry == nil || clientID == "" || clientSecret == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := as.clientRegistry.GetClient(ctx, clientID)
+	if errors.Is(err, repository.ErrClientNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyClientSecretHash, []byte(clientSecret))
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %v", err)
+	}
+
+	if err := checkClientSecret(client, clientSecret); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// checkClientSecret сверяет секрет с bcrypt хэшем клиента из реестра
+func checkClientSecret(client *models.OAuthClient, clientSecret string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(client.ClientSecretHash), []byte(clientSecret)); err != nil {
+		fmt.Printf("Client %s authentication failed\n", client.ClientID)
+		return ErrInvalidClient
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"juniortest/internal/models"
+	"juniortest/pkg/dpop"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Discovery собирает документ OpenID Connect discovery для стандартных клиентских библиотек
+func (as *AuthService) Discovery() *models.OpenIDConfiguration {
+	issuer := as.policy.Issuer
+
+	// client_credentials и authorization_code доступны только клиентам из реестра,
+	// точка входа для authorization_code появляется вместе с grant
+	grantTypes := []string{models.GrantTypeRefreshToken}
+	authorizationEndpoint := ""
+	if as.clientRegistry != nil {
+		grantTypes = append(grantTypes, models.GrantTypeClientCredentials)
+		if as.codes != nil {
+			grantTypes = append(grantTypes, models.GrantTypeAuthorizationCode)
+			authorizationEndpoint = issuer + "/oauth2/authorize"
+		}
+	}
+
+	// Без опубликованных ключей проверять подпись токенов сторонним сервисам нечем
+	jwksURI := ""
+	if as.publishKeys {
+		jwksURI = issuer + "/.well-known/jwks.json"
+	}
+
+	return &models.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             authorizationEndpoint,
+		TokenEndpoint:                     issuer + "/oauth2/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           jwksURI,
+		IntrospectionEndpoint:             issuer + "/introspect",
+		RevocationEndpoint:                issuer + "/revoke",
+		GrantTypesSupported:               grantTypes,
+		ResponseTypesSupported:            []string{"code"}, // Обязательное поле, ID токены сервис не выдает
+		SubjectTypesSupported:             []string{"public"},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		DPoPSigningAlgValuesSupported:     dpop.Algorithms,
+		TLSClientCertificateBoundTokens:   as.mutualTLS,
+	}
+}
+
+// Issuer возвращает публичный адрес сервиса
+func (as *AuthService) Issuer() string {
+	return as.policy.Issuer
+}
+
+// signingAlgorithms возвращает алгоритмы всех ключей связки без повторов
+func (as *AuthService) signingAlgorithms() []string {
+	algorithms := []string{}
+	seen := map[string]bool{}
+
+	for _, key := range as.keyRing.Keys() {
+		alg := key.Signer.Method().Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+
+	return algorithms
+}
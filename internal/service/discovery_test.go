@@ -0,0 +1,55 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// discoveryFields возвращает документ discovery в виде полей JSON
+func discoveryFields(t *testing.T, as *AuthService) map[string]interface{} {
+	t.Helper()
+	document, err := json.Marshal(as.Discovery())
+	if err != nil {
+		t.Fatalf("marshal discovery: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(document, &fields); err != nil {
+		t.Fatalf("unmarshal discovery: %v", err)
+	}
+	return fields
+}
+
+func TestDiscovery(t *testing.T) {
+	fields := discoveryFields(t, newTestAuthService(t, newFakeTokenRepository()))
+
+	// response_types_supported обязателен и не бывает пустым, ID токены не выдаются
+	responseTypes, _ := fields["response_types_supported"].([]interface{})
+	if len(responseTypes) != 1 || responseTypes[0] != "code" {
+		t.Errorf("response_types_supported = %v, want [code]", fields["response_types_supported"])
+	}
+	if _, ok := fields["id_token_signing_alg_values_supported"]; ok {
+		t.Error("id_token_signing_alg_values_supported is advertised")
+	}
+	// Без реестра клиентов и хранилища кодов authorization endpoint не объявляется
+	if _, ok := fields["authorization_endpoint"]; ok {
+		t.Error("authorization_endpoint is advertised without authorization_code grant")
+	}
+}
+
+func TestDiscoveryJWKSURI(t *testing.T) {
+	as := newTestAuthService(t, newFakeTokenRepository())
+
+	// HMAC связку не публикуем, и discovery не должен ссылаться на пустой JWKS
+	if uri, ok := discoveryFields(t, as)["jwks_uri"]; ok {
+		t.Errorf("jwks_uri = %v without published keys", uri)
+	}
+
+	WithPublishedKeys(true)(as)
+	if uri := discoveryFields(t, as)["jwks_uri"]; uri != "http://auth.test/.well-known/jwks.json" {
+		t.Errorf("jwks_uri = %v", uri)
+	}
+}
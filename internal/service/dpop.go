@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/repository"
+	"juniortest/pkg/dpop"
+	"juniortest/pkg/jose"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Тип bearer токена в ответах token endpoint, привязанные токены выдаются с типом dpop.Scheme
+const bearerTokenType = "Bearer"
+
+// DPoPPolicy - параметры проверки DPoP proof (RFC 9449)
+type DPoPPolicy struct {
+	ProofLifetime time.Duration // Насколько старым может быть iat proof, столько же хранится его jti
+	NonceLifetime time.Duration // Время жизни nonce сервера на token endpoint, 0 - nonce не требуется
+}
+
+// Политика по умолчанию: proof живет минуту, nonce не требуется
+var defaultDPoPPolicy = DPoPPolicy{ProofLifetime: time.Minute}
+
+// WithDPoP задает политику DPoP и хранилище одноразовых ключей (jti предъявленных proof и погашенных mfa токенов),
+// по умолчанию хранилище в памяти процесса
+func WithDPoP(policy DPoPPolicy, replay repository.ReplayCache) Option {
+	return func(as *AuthService) {
+		if policy.ProofLifetime <= 0 {
+			policy.ProofLifetime = defaultDPoPPolicy.ProofLifetime
+		}
+		as.dpopPolicy = policy
+		as.replay = replay
+	}
+}
+
+// DPoPProof - proof из заголовка DPoP и запрос, к которому он относится
+type DPoPProof struct {
+	Proof  string // Значение заголовка DPoP, пусто - клиент не использует DPoP
+	Method string // Метод запроса, claim htm
+	Path   string // Путь запроса, адрес для claim htu собирается от Issuer
+}
+
+// checkDPoPProof проверяет proof на token endpoint и возвращает отпечаток ключа, пусто - клиент не прислал proof
+func (as *AuthService) checkDPoPProof(ctx context.Context, proof DPoPProof) (string, error) {
+	if proof.Proof == "" {
+		return "", nil
+	}
+
+	p, err := as.verifyDPoPProof(ctx, proof, "")
+	if err != nil {
+		return "", err
+	}
+	return p.JKT, nil
+}
+
+// VerifyDPoPBinding проверяет, что access token, привязанный к ключу DPoP, предъявлен с proof этого ключа
+func (as *AuthService) VerifyDPoPBinding(ctx context.Context, claims *jose.Claims, accessToken string, proof DPoPProof) error {
+	p, err := as.verifyDPoPProof(ctx, proof, accessToken)
+	if err != nil {
+		return err
+	}
+	if p.JKT != claims.DPoPKey() {
+		fmt.Printf("DPoP proof key does not match access token %s\n", claims.TokenID)
+		return fmt.Errorf("%w: proof key does not match token binding", ErrInvalidDPoPProof)
+	}
+	return nil
+}
+
+// verifyDPoPProof проверяет proof и отсекает повторы по jti.
+// На token endpoint (accessToken пустой) при включенных nonce proof обязан нести живой nonce сервера.
+func (as *AuthService) verifyDPoPProof(ctx context.Context, proof DPoPProof, accessToken string) (*dpop.Proof, error) {
+	p, err := dpop.Verify(proof.Proof, dpop.Request{
+		Method:      proof.Method,
+		URL:         strings.TrimSuffix(as.policy.Issuer, "/") + proof.Path,
+		AccessToken: accessToken,
+		MaxAge:      as.dpopPolicy.ProofLifetime,
+		Leeway:      as.policy.Leeway,
+	})
+	if err != nil {
+		fmt.Printf("DPoP proof validation failed: %v\n", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	// Nonce проверяется до записи jti, чтобы клиент мог повторить запрос с новым proof
+	if accessToken == "" && as.dpopPolicy.NonceLifetime > 0 && !as.validDPoPNonce(p.Nonce) {
+		return nil, ErrUseDPoPNonce
+	}
+
+	// jti помнится, пока proof еще могут принять по iat, ключ уникален в пределах ключа клиента
+	expiresAt := p.IssuedAt.Add(as.dpopPolicy.ProofLifetime + as.policy.Leeway)
+	fresh, err := as.replay.Remember(ctx, p.JKT+":"+p.ID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check dpop proof replay: %v", err)
+	}
+	if !fresh {
+		fmt.Printf("DPoP proof %s replayed\n", p.ID)
+		return nil, fmt.Errorf("%w: proof already used", ErrInvalidDPoPProof)
+	}
+
+	return p, nil
+}
+
+// DPoPNonce выдает свежий nonce для заголовка DPoP-Nonce, пусто - nonce не требуются
+func (as *AuthService) DPoPNonce() (string, error) {
+	if as.dpopPolicy.NonceLifetime <= 0 {
+		return "", nil
+	}
+
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		Issuer:    as.policy.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(as.dpopPolicy.NonceLifetime)),
+	}
+	return as.signToken(claims, jose.TypeDPoPNonce)
+}
+
+// validDPoPNonce проверяет, что nonce выдан этим сервисом и еще не истек
+func (as *AuthService) validDPoPNonce(nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+
+	token, err := jwt.ParseWithClaims(nonce, &jwt.RegisteredClaims{}, as.keyRing.Keyfunc,
+		jwt.WithValidMethods(as.signingAlgorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(as.policy.Issuer),
+		jwt.WithLeeway(as.policy.Leeway),
+	)
+	if err != nil {
+		fmt.Printf("DPoP nonce validation failed: %v\n", err)
+		return false
+	}
+
+	typ, _ := token.Header["typ"].(string)
+	return typ == jose.TypeDPoPNonce
+}
+
+// tokenType возвращает token_type для ответа: DPoP для токенов, привязанных к ключу, иначе Bearer
+func tokenType(jkt string) string {
+	if jkt != "" {
+		return dpop.Scheme
+	}
+	return bearerTokenType
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// ErrInvalidGrant - базовая ошибка для всех отказов по вине предъявленного refresh token.
+// Обработчики по ней отличают ошибку клиента (invalid_grant) от внутренней ошибки сервиса.
+var ErrInvalidGrant = errors.New("invalid grant")
+
+// Конкретные причины отказа, все они оборачивают ErrInvalidGrant
+var (
+	ErrInvalidRefreshToken = fmt.Errorf("%w: refresh token not found or expired", ErrInvalidGrant)
+	ErrTokenReused         = fmt.Errorf("%w: token_reused", ErrInvalidGrant)
+	ErrRefreshTokenUsed    = fmt.Errorf("%w: refresh token already used", ErrInvalidGrant)
+	ErrSessionExpired      = fmt.Errorf("%w: session expired", ErrInvalidGrant)
+	ErrClientIPMismatch    = fmt.Errorf("%w: invalid client IP", ErrInvalidGrant)
+	ErrDeviceMismatch      = fmt.Errorf("%w: refresh token is bound to another device", ErrInvalidGrant)
+	ErrTokenPairMismatch   = fmt.Errorf("%w: refresh token was not issued with this access token", ErrInvalidGrant)
+	ErrClientMismatch      = fmt.Errorf("%w: token was issued to another client", ErrInvalidGrant)
+	ErrInvalidCode         = fmt.Errorf("%w: authorization code is invalid, expired or already used", ErrInvalidGrant)
+	ErrInvalidCodeVerifier = fmt.Errorf("%w: code_verifier does not match code_challenge", ErrInvalidGrant)
+	ErrDPoPKeyMismatch     = fmt.Errorf("%w: refresh token is bound to another dpop key", ErrInvalidGrant)
+	ErrCertificateMismatch = fmt.Errorf("%w: refresh token is bound to another client certificate", ErrInvalidGrant)
+)
+
+// Ошибки проверки access токена и учетных данных клиента
+var (
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrInvalidClient      = errors.New("invalid client credentials")
+)
+
+// Отказы клиенту из реестра, соответствуют кодам unauthorized_client и invalid_scope из RFC 6749
+var (
+	ErrUnauthorizedClient = errors.New("client is not allowed to use this grant type")
+	ErrInvalidScope       = errors.New("requested scope is not allowed")
+)
+
+// Ошибка формата user_id в GET /tokens
+var ErrInvalidUserID = errors.New("invalid user_id format")
+
+// ErrUserNotAllowed - базовая ошибка для отказа в выдаче токенов пользователю
+var ErrUserNotAllowed = errors.New("user is not allowed to sign in")
+
+// Конкретные причины отказа пользователю, оборачивают ErrUserNotAllowed
+var (
+	ErrUnknownUser  = fmt.Errorf("%w: unknown user", ErrUserNotAllowed)
+	ErrUserDisabled = fmt.Errorf("%w: user is disabled or locked", ErrUserNotAllowed)
+)
+
+// Ошибка входа по паролю, одинаковая для всех причин отказа
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrInvalidAuthorizeRequest - базовая ошибка запроса к /oauth2/authorize, о ней сообщается через redirect_uri.
+// ErrInvalidRedirectURI отдельная: на незарегистрированный адрес перенаправлять нельзя.
+var (
+	ErrInvalidAuthorizeRequest = errors.New("invalid authorization request")
+	ErrUnsupportedResponseType = fmt.Errorf("%w: only response_type=code is supported", ErrInvalidAuthorizeRequest)
+	ErrPKCERequired            = fmt.Errorf("%w: code_challenge with code_challenge_method=S256 is required", ErrInvalidAuthorizeRequest)
+	ErrInvalidRedirectURI      = errors.New("redirect_uri is not registered for this client")
+)
+
+// Ошибки второго фактора
+var (
+	ErrMFANotEnrolled     = errors.New("mfa is not enrolled")
+	ErrMFAAlreadyEnrolled = errors.New("mfa is already enrolled")
+	ErrInvalidMFAToken    = errors.New("invalid or expired mfa token")
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+	ErrMFARequired        = errors.New("second factor is required")
+)
+
+// Ошибки DPoP (RFC 9449), соответствуют кодам invalid_dpop_proof и use_dpop_nonce
+var (
+	ErrInvalidDPoPProof = errors.New("invalid dpop proof")
+	ErrUseDPoPNonce     = errors.New("dpop proof must contain a server nonce")
+)
+
+// Ошибка, когда сессии нет среди живых сессий пользователя
+var ErrSessionNotFound = errors.New("session not found")
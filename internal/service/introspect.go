@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Introspect сообщает, активен ли токен (RFC 7662).
+// Тип определяется по виду токена: JWT проверяется как access token, остальное ищется среди refresh токенов.
+// Подсказка token_type_hint не нужна, т.к. форматы токенов не пересекаются.
+func (as *AuthService) Introspect(ctx context.Context, token string) (*models.Introspection, error) {
+	if token == "" {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	// Access token - это JWT из трех частей через точку, в base64 refresh токене точек нет
+	if strings.Count(token, ".") == 2 {
+		return as.introspectAccessToken(ctx, token), nil
+	}
+
+	return as.introspectRefreshToken(ctx, token)
+}
+
+// introspectAccessToken проверяет подпись и срок действия access token
+func (as *AuthService) introspectAccessToken(ctx context.Context, token string) *models.Introspection {
+	claims, err := as.validateAccessToken(ctx, token)
+	if err != nil {
+		return &models.Introspection{Active: false}
+	}
+
+	result := &models.Introspection{
+		Active:    true,
+		TokenType: "access_token",
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+		ClientIP:  claims.ClientIP,
+		TokenID:   claims.TokenID.String(),
+		AMR:       claims.AMR,
+		ACR:       claims.ACR,
+		Cnf:       claims.Cnf,
+	}
+	if claims.ExpiresAt != nil {
+		result.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		result.Nbf = claims.NotBefore.Unix()
+	}
+
+	return result
+}
+
+// introspectRefreshToken ищет живую строку refresh_tokens по токену.
+// Токен активен, только если его еще можно обменять: проверки те же, что и в RefreshToken.
+func (as *AuthService) introspectRefreshToken(ctx context.Context, token string) (*models.Introspection, error) {
+	selector, verifier := splitRefreshToken(token)
+
+	tokenData, err := as.tokenRepository.GetRefreshToken(ctx, selector, verifier)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return &models.Introspection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %v", err)
+	}
+
+	// Использованный или отозванный токен уже не активен
+	if tokenData.Used || tokenData.RevokedAt != nil {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	// Истекшая по бездействию или по пределу сессия, а также отключенный пользователь
+	if err := as.checkSession(tokenData, time.Now()); err != nil {
+		return &models.Introspection{Active: false}, nil
+	}
+	if _, err := as.checkUser(ctx, tokenData.UserID); err != nil {
+		if errors.Is(err, ErrUserNotAllowed) {
+			return &models.Introspection{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	return &models.Introspection{
+		Active:    true,
+		TokenType: "refresh_token",
+		Sub:       tokenData.UserID.String(),
+		ClientID:  tokenData.ClientID,
+		Scope:     tokenData.Scope,
+		Exp:       tokenData.ExpiresAt.Unix(),
+		Iat:       tokenData.CreatedAt.Unix(),
+		ClientIP:  tokenData.ClientIP,
+		TokenID:   tokenData.ID.String(),
+		AMR:       tokenData.AMR,
+		ACR:       tokenData.ACR,
+		Cnf:       confirmation(tokenData.DPoPJKT, tokenData.CertThumbprint),
+	}, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"juniortest/internal/directory"
+	"juniortest/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// fakeUserDirectory - каталог пользователей в памяти для тестов
+type fakeUserDirectory map[uuid.UUID]*models.User
+
+func (d fakeUserDirectory) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, ok := d[userID]
+	if !ok {
+		return nil, directory.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     func(p *TokenPolicy)
+		row        func(token *models.RefreshTokenData)
+		status     string
+		wantActive bool
+	}{
+		{
+			name:       "live session",
+			status:     models.UserStatusActive,
+			wantActive: true,
+		},
+		{
+			name:   "used token",
+			row:    func(token *models.RefreshTokenData) { token.Used = true },
+			status: models.UserStatusActive,
+		},
+		{
+			name:   "idle timeout exceeded",
+			policy: func(p *TokenPolicy) { p.IdleTimeout = time.Hour },
+			row:    func(token *models.RefreshTokenData) { token.CreatedAt = time.Now().Add(-2 * time.Hour) },
+			status: models.UserStatusActive,
+		},
+		{
+			name:   "session lifetime exceeded",
+			policy: func(p *TokenPolicy) { p.SessionLifetime = 24 * time.Hour },
+			row:    func(token *models.RefreshTokenData) { token.SessionStartedAt = time.Now().Add(-48 * time.Hour) },
+			status: models.UserStatusActive,
+		},
+		{
+			name:   "disabled user",
+			status: models.UserStatusDisabled,
+		},
+		{
+			name:   "locked user",
+			status: models.UserStatusLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTokenRepository()
+			as := newTestAuthService(t, repo)
+
+			userID := uuid.New()
+			users := fakeUserDirectory{userID: {ID: userID, Status: models.UserStatusActive}}
+			as.users = users
+
+			tokens, err := as.CreateTokenPair(context.Background(), userID, "10.0.0.1", "")
+			if err != nil {
+				t.Fatalf("CreateTokenPair: %v", err)
+			}
+
+			if tt.policy != nil {
+				tt.policy(&as.policy)
+			}
+			if tt.row != nil {
+				token := repo.all()[0]
+				tt.row(&token)
+				if err := repo.SaveRefreshToken(context.Background(), &token); err != nil {
+					t.Fatalf("SaveRefreshToken: %v", err)
+				}
+			}
+			users[userID].Status = tt.status
+
+			result, err := as.Introspect(context.Background(), tokens.RefreshToken)
+			if err != nil {
+				t.Fatalf("Introspect: %v", err)
+			}
+			if result.Active != tt.wantActive {
+				t.Errorf("active = %v, want %v", result.Active, tt.wantActive)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"juniortest/pkg/jose"
+	"math/big"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// WithPublishedKeys объявляет в discovery адрес JWKS, по которому сторонние сервисы берут ключи проверки.
+// Связку с HMAC ключами публиковать нельзя, см. KeyRing.Publishable.
+func WithPublishedKeys(enabled bool) Option {
+	return func(as *AuthService) {
+		as.publishKeys = enabled
+	}
+}
+
+// JWKS возвращает публичные части всех ключей связки, включая ожидающие и еще не удаленные выведенные,
+// чтобы потребители заранее знали новый ключ и могли проверить токены, подписанные старым.
+// HMAC ключи не публикуются.
+func (as *AuthService) JWKS() *jose.JWKSet {
+	set := &jose.JWKSet{Keys: []jose.JWK{}}
+
+	for _, key := range as.keyRing.Keys() {
+		jwk, ok := publicJWK(key.ID, key.Signer.Method().Alg(), key.Signer.PublicKey())
+		if !ok {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// publicJWK конвертирует публичный ключ в JWK, false если ключ не поддерживается или это HMAC
+func publicJWK(kid, alg string, publicKey crypto.PublicKey) (jose.JWK, bool) {
+	jwk := jose.JWK{Kid: kid, Use: "sig", Alg: alg}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeJWKInt(key.N, 0)
+		jwk.E = encodeJWKInt(big.NewInt(int64(key.E)), 0)
+
+	case *ecdsa.PublicKey:
+		// Координаты дополняются нулями до размера кривой, как требует RFC 7518
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = encodeJWKInt(key.X, size)
+		jwk.Y = encodeJWKInt(key.Y, size)
+
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+
+	default:
+		return jose.JWK{}, false
+	}
+
+	return jwk, true
+}
+
+// encodeJWKInt кодирует число в base64url без паддинга, size > 0 задает фиксированную длину в байтах
+func encodeJWKInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if size > len(b) {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		b = padded
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
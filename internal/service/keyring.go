@@ -0,0 +1,206 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Состояние ключа подписи в связке
+type KeyState string
+
+const (
+	KeyPending KeyState = "pending" // Ключ опубликован, но еще не подписывает токены
+	KeyActive  KeyState = "active"  // Ключ подписывает новые токены
+	KeyRetired KeyState = "retired" // Ключ только проверяет уже выданные токены
+)
+
+// SigningKey - ключ подписи с идентификатором (kid) и расписанием ротации
+type SigningKey struct {
+	ID         string
+	Signer     Signer
+	ActivateAt time.Time // Начало подписи новых токенов, нулевое значение - сразу
+	RetireAt   time.Time // Окончание подписи новых токенов, нулевое значение - никогда
+}
+
+// State возвращает состояние ключа на момент now
+func (k *SigningKey) State(now time.Time) KeyState {
+	if !k.ActivateAt.IsZero() && now.Before(k.ActivateAt) {
+		return KeyPending
+	}
+	if !k.RetireAt.IsZero() && !now.Before(k.RetireAt) {
+		return KeyRetired
+	}
+	return KeyActive
+}
+
+// KeyRing - связка ключей: один активный ключ подписи и любое число ключей только для проверки.
+// Выведенные из ротации ключи удаляются, когда подписанные ими access токены гарантированно истекли.
+type KeyRing struct {
+	mu        sync.RWMutex
+	keys      []*SigningKey
+	retention time.Duration // Сколько хранить выведенный ключ: максимальный TTL access token плюс leeway
+	now       func() time.Time
+}
+
+// NewKeyRing создает связку ключей, retention - максимальное время жизни access token с учетом leeway
+func NewKeyRing(retention time.Duration, keys ...*SigningKey) (*KeyRing, error) {
+	kr := &KeyRing{retention: retention, now: time.Now}
+	for _, key := range keys {
+		if err := kr.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// Add добавляет ключ в связку, идентификаторы ключей должны быть уникальными
+func (kr *KeyRing) Add(key *SigningKey) error {
+	if key.ID == "" {
+		return fmt.Errorf("signing key id is required")
+	}
+	if key.Signer == nil {
+		return fmt.Errorf("signing key %s has no signer", key.ID)
+	}
+	if !key.ActivateAt.IsZero() && !key.RetireAt.IsZero() && !key.RetireAt.After(key.ActivateAt) {
+		return fmt.Errorf("signing key %s retires before it activates", key.ID)
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	for _, existing := range kr.keys {
+		if existing.ID == key.ID {
+			return fmt.Errorf("duplicate signing key id: %s", key.ID)
+		}
+	}
+
+	kr.keys = append(kr.keys, key)
+	return nil
+}
+
+// SigningKey возвращает активный ключ для подписи новых токенов.
+// Если активных ключей несколько, выбирается активированный последним.
+func (kr *KeyRing) SigningKey() (*SigningKey, error) {
+	now := kr.prune()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	var active *SigningKey
+	for _, key := range kr.keys {
+		if key.State(now) != KeyActive {
+			continue
+		}
+		if active == nil || key.ActivateAt.After(active.ActivateAt) {
+			active = key
+		}
+	}
+
+	if active == nil {
+		return nil, fmt.Errorf("no active signing key")
+	}
+	return active, nil
+}
+
+// VerificationKey возвращает ключ по kid для проверки подписи, включая ожидающие и выведенные ключи
+func (kr *KeyRing) VerificationKey(kid string) (*SigningKey, error) {
+	kr.prune()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	for _, key := range kr.keys {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key id: %s", kid)
+}
+
+// Keys возвращает все ключи, которые еще могут встретиться в живых токенах
+func (kr *KeyRing) Keys() []*SigningKey {
+	kr.prune()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	keys := make([]*SigningKey, len(kr.keys))
+	copy(keys, kr.keys)
+	return keys
+}
+
+// Publishable проверяет, что у всех ключей связки есть публичная часть для JWKS.
+// HMAC ключ публиковать нельзя, а без него потребители не смогут проверить подписанные им токены.
+func (kr *KeyRing) Publishable() error {
+	for _, key := range kr.Keys() {
+		if key.Signer.PublicKey() == nil {
+			return fmt.Errorf("signing key %s uses symmetric algorithm %s", key.ID, key.Signer.Method().Alg())
+		}
+	}
+	return nil
+}
+
+// Keyfunc - функция для jwt.Parse, выбирает ключ по заголовку kid и сверяет алгоритм
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+
+	key, err := kr.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Signer.Method().Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+	return key.Signer.VerifyKey(), nil
+}
+
+// prune удаляет ключи, выведенные из ротации дольше retention назад, и возвращает текущее время.
+// Удалять нужно редко, поэтому сначала ключи проверяются под блокировкой на чтение,
+// и параллельные проверки токенов не выстраиваются в очередь за блокировкой на запись.
+func (kr *KeyRing) prune() time.Time {
+	now := kr.now()
+
+	kr.mu.RLock()
+	stale := false
+	for _, key := range kr.keys {
+		if kr.expired(key, now) {
+			stale = true
+			break
+		}
+	}
+	kr.mu.RUnlock()
+	if !stale {
+		return now
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	keys := kr.keys[:0]
+	for _, key := range kr.keys {
+		if kr.expired(key, now) {
+			fmt.Printf("Dropping retired signing key: %s\n", key.ID)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	kr.keys = keys
+
+	return now
+}
+
+// expired сообщает, что подписанные ключом токены уже истекли и ключ можно удалить
+func (kr *KeyRing) expired(key *SigningKey, now time.Time) bool {
+	return key.State(now) == KeyRetired && now.After(key.RetireAt.Add(kr.retention))
+}
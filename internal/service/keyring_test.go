@@ -0,0 +1,69 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// newTestECSigner создает Signer ES256 на новом ключе P-256
+func newTestECSigner(t *testing.T) Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	signer, err := newPEMSigner(jwt.SigningMethodES256, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("newPEMSigner: %v", err)
+	}
+	return signer
+}
+
+func TestKeyRingPublishable(t *testing.T) {
+	hmac, err := NewSigner("HS512", []byte("test-secret"), "")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		signers []Signer
+		wantErr bool
+	}{
+		{"asymmetric key", []Signer{newTestECSigner(t)}, false},
+		{"symmetric key", []Signer{hmac}, true},
+		{"symmetric key during rotation", []Signer{newTestECSigner(t), hmac}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyRing, err := NewKeyRing(time.Hour)
+			if err != nil {
+				t.Fatalf("NewKeyRing: %v", err)
+			}
+			for i, signer := range tt.signers {
+				if err := keyRing.Add(&SigningKey{ID: string(rune('a' + i)), Signer: signer}); err != nil {
+					t.Fatalf("Add: %v", err)
+				}
+			}
+			if err := keyRing.Publishable(); (err != nil) != tt.wantErr {
+				t.Errorf("Publishable error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
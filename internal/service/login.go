@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// LoginPolicy - правила блокировки при подборе пароля
+type LoginPolicy struct {
+	MaxFailedAttempts int           // Сколько неудачных попыток подряд допускается до блокировки
+	LockoutDuration   time.Duration // На сколько блокируется вход после MaxFailedAttempts неудач
+}
+
+// LoginParams - входные данные для входа по паролю
+type LoginParams struct {
+	Login          string // Username или email
+	Password       string
+	Scope          string // Запрошенные scope через пробел, пусто - scope по умолчанию
+	ClientIP       string
+	UserAgent      string
+	DeviceID       string // Необязательный идентификатор устройства, к нему привязывается сессия
+	AcceptLanguage string // Часть отпечатка устройства
+	CertThumbprint string // Отпечаток клиентского сертификата mTLS, к нему привязываются токены
+}
+
+// WithCredentials включает вход по паролю
+func WithCredentials(credentials repository.CredentialRepository, policy LoginPolicy) Option {
+	return func(as *AuthService) {
+		as.credentials = credentials
+		as.loginPolicy = policy
+	}
+}
+
+// Login проверяет логин и пароль и выдает пару токенов через CreateTokenPair.
+// Если у пользователя подключен TOTP, вместо токенов выдается mfa_token для второго шага (CompleteMFALogin).
+// Для неизвестного логина, неверного пароля и заблокированной учетной записи ответ одинаковый
+// и занимает одинаковое время, чтобы по нему нельзя было перебирать пользователей.
+func (as *AuthService) Login(ctx context.Context, params LoginParams) (*models.LoginResult, error) {
+	if as.credentials == nil {
+		return nil, fmt.Errorf("password login is not configured")
+	}
+
+	credentials, err := as.authenticatePassword(ctx, params.Login, params.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Отключенный пользователь не получает и промежуточный токен второго фактора
+	if _, err := as.checkUser(ctx, credentials.UserID); err != nil {
+		return nil, err
+	}
+
+	// Пароль верный, но пользователь подключил второй фактор
+	enrolled, err := as.totpEnrolled(ctx, credentials.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		mfaToken, expiresAt, err := as.issueMFAToken(credentials.UserID, params.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue mfa token: %v", err)
+		}
+		fmt.Printf("MFA required for user %s\n", credentials.UserID)
+		return &models.LoginResult{
+			MFARequired:  true,
+			MFAToken:     mfaToken,
+			MFAExpiresIn: int64(time.Until(expiresAt).Seconds()),
+		}, nil
+	}
+
+	device := newDevice(params.ClientIP, params.UserAgent, params.DeviceID, params.AcceptLanguage)
+	tokens, err := as.startSession(ctx, grant{
+		UserID:         credentials.UserID,
+		ClientIP:       params.ClientIP,
+		UserAgent:      params.UserAgent,
+		DeviceID:       device.DeviceID,
+		Fingerprint:    device.Fingerprint,
+		AMR:            []string{models.AMRPassword},
+		ACR:            models.ACRSingleFactor,
+		Scope:          params.Scope,
+		CertThumbprint: params.CertThumbprint,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResult{AccessTokenRefreshToken: tokens}, nil
+}
+
+// authenticatePassword проверяет пароль и ведет счетчик неудачных попыток
+func (as *AuthService) authenticatePassword(ctx context.Context, login, password string) (*models.UserCredentials, error) {
+	credentials, err := as.credentials.GetCredentials(ctx, login)
+	if errors.Is(err, repository.ErrCredentialsNotFound) {
+		burnPasswordCheck(password)
+		fmt.Printf("Login failed: unknown login\n")
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %v", err)
+	}
+
+	// Пароль проверяется всегда, даже для заблокированной учетной записи, чтобы не выдавать блокировку временем ответа
+	passwordOK := VerifyPassword(credentials.PasswordHash, password)
+
+	if credentials.LockedUntil != nil && time.Now().Before(*credentials.LockedUntil) {
+		fmt.Printf("Login failed: user %s is locked until %s\n", credentials.UserID, credentials.LockedUntil)
+		return nil, ErrInvalidCredentials
+	}
+
+	if !passwordOK {
+		fmt.Printf("Login failed: wrong password for user %s\n", credentials.UserID)
+		err := as.credentials.RecordLoginFailure(ctx, credentials.UserID, as.loginPolicy.MaxFailedAttempts, as.loginPolicy.LockoutDuration)
+		if err != nil {
+			fmt.Printf("Failed to record login failure: %v\n", err)
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if credentials.FailedLogins > 0 || credentials.LockedUntil != nil {
+		if err := as.credentials.ResetLoginFailures(ctx, credentials.UserID); err != nil {
+			fmt.Printf("Failed to reset login failures: %v\n", err)
+		}
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"juniortest/pkg/jose"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Claims промежуточного токена: запрошенные при входе scope переносятся на второй шаг
+type mfaClaims struct {
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// MFAPolicy - параметры второго фактора
+type MFAPolicy struct {
+	Issuer        string        // Название сервиса в приложении-аутентификаторе
+	ChallengeTTL  time.Duration // Сколько после пароля ждать код второго фактора
+	RecoveryCodes int           // Сколько кодов восстановления выдавать при подключении
+}
+
+// MFALoginParams - входные данные второго шага входа
+type MFALoginParams struct {
+	MFAToken       string // Токен, выданный после проверки пароля
+	Code           string // Код из приложения-аутентификатора
+	RecoveryCode   string // Или одноразовый код восстановления
+	ClientIP       string
+	UserAgent      string
+	DeviceID       string
+	AcceptLanguage string
+	CertThumbprint string
+}
+
+// WithMFA включает второй фактор TOTP
+func WithMFA(mfa repository.MFARepository, policy MFAPolicy) Option {
+	return func(as *AuthService) {
+		as.mfa = mfa
+		as.mfaPolicy = policy
+	}
+}
+
+// EnrollTOTP создает новый секрет TOTP и возвращает его вместе с otpauth:// URI.
+// Второй фактор начинает требоваться только после подтверждения первым кодом через ConfirmTOTP.
+func (as *AuthService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTPProvisioning, error) {
+	if as.mfa == nil {
+		return nil, fmt.Errorf("mfa is not configured")
+	}
+
+	// В приложении учетная запись подписывается адресом или логином, без каталога - ID пользователя
+	user, err := as.checkUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	account := userID.String()
+	if user != nil {
+		if user.Email != "" {
+			account = user.Email
+		} else if user.Username != "" {
+			account = user.Username
+		}
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %v", err)
+	}
+
+	err = as.mfa.SaveTOTPSecret(ctx, userID, secret)
+	if errors.Is(err, repository.ErrMFAAlreadyEnrolled) {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save totp secret: %v", err)
+	}
+
+	fmt.Printf("TOTP enrollment started for user %s\n", userID)
+	return &models.TOTPProvisioning{
+		Secret: secret,
+		URI:    totpURI(as.mfaPolicy.Issuer, account, secret),
+	}, nil
+}
+
+// ConfirmTOTP подтверждает подключение TOTP первым кодом и возвращает коды восстановления.
+// Коды показываются пользователю один раз, в БД остаются только их хэши.
+// Неверные коды учитываются в счетчике блокировки, как и на втором шаге входа.
+func (as *AuthService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if as.mfa == nil || as.credentials == nil {
+		return nil, fmt.Errorf("mfa is not configured")
+	}
+
+	// Второй фактор относится только ко входу по паролю
+	credentials, err := as.secondFactorCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := as.mfa.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotEnrolled) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp: %v", err)
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+
+	step, ok := matchTOTP(enrollment.Secret, code, time.Now())
+	if err := as.recordSecondFactor(ctx, credentials, ok); err != nil {
+		return nil, err
+	}
+
+	codes, err := generateRecoveryCodes(as.mfaPolicy.RecoveryCodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %v", err)
+	}
+	hashes := make([]string, len(codes))
+	for i, recoveryCode := range codes {
+		hashes[i] = hashRecoveryCode(recoveryCode)
+	}
+
+	err = as.mfa.ConfirmTOTP(ctx, userID, step, hashes)
+	if errors.Is(err, repository.ErrMFAAlreadyEnrolled) {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm totp: %v", err)
+	}
+
+	fmt.Printf("TOTP enrollment confirmed for user %s\n", userID)
+	return codes, nil
+}
+
+// CompleteMFALogin завершает вход вторым фактором: кодом TOTP или кодом восстановления
+func (as *AuthService) CompleteMFALogin(ctx context.Context, params MFALoginParams) (*models.AccessTokenRefreshToken, error) {
+	if as.mfa == nil || as.credentials == nil {
+		return nil, fmt.Errorf("mfa is not configured")
+	}
+
+	claims, userID, err := as.parseMFAToken(params.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	amr, err := as.verifySecondFactor(ctx, userID, params.Code, params.RecoveryCode)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		return nil, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := as.useMFAToken(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	device := newDevice(params.ClientIP, params.UserAgent, params.DeviceID, params.AcceptLanguage)
+	return as.startSession(ctx, grant{
+		UserID:         userID,
+		ClientIP:       params.ClientIP,
+		UserAgent:      params.UserAgent,
+		DeviceID:       device.DeviceID,
+		Fingerprint:    device.Fingerprint,
+		AMR:            amr,
+		ACR:            models.ACRMultiFactor,
+		Scope:          claims.Scope,
+		CertThumbprint: params.CertThumbprint,
+	})
+}
+
+// verifySecondFactor проверяет код TOTP или код восстановления и возвращает amr для токенов.
+// Неверные коды учитываются в том же счетчике, что и неверные пароли, поэтому перебор упирается в блокировку.
+func (as *AuthService) verifySecondFactor(ctx context.Context, userID uuid.UUID, code, recoveryCode string) ([]string, error) {
+	credentials, err := as.secondFactorCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := as.mfa.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotEnrolled) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp: %v", err)
+	}
+	if enrollment.ConfirmedAt == nil {
+		return nil, ErrMFANotEnrolled
+	}
+
+	// Проверка второго фактора, принятый шаг или код погашаются атомарно
+	amr := []string{models.AMRPassword}
+	var ok bool
+	switch {
+	case code != "":
+		var step int64
+		if step, ok = matchTOTP(enrollment.Secret, code, time.Now()); ok {
+			if ok, err = as.mfa.UseTOTPStep(ctx, userID, step); err != nil {
+				return nil, fmt.Errorf("failed to use totp step: %v", err)
+			}
+		}
+		amr = append(amr, models.AMROTP)
+	case recoveryCode != "":
+		if ok, err = as.mfa.UseRecoveryCode(ctx, userID, hashRecoveryCode(recoveryCode)); err != nil {
+			return nil, fmt.Errorf("failed to use recovery code: %v", err)
+		}
+		if ok {
+			fmt.Printf("Recovery code used by user %s\n", userID)
+		}
+	}
+
+	if err := as.recordSecondFactor(ctx, credentials, ok); err != nil {
+		return nil, err
+	}
+	return append(amr, models.AMRMFA), nil
+}
+
+// secondFactorCredentials возвращает учетные данные пользователя, если он не заблокирован.
+// Без учетных данных второй фактор не подключить: он проверяется только после пароля.
+func (as *AuthService) secondFactorCredentials(ctx context.Context, userID uuid.UUID) (*models.UserCredentials, error) {
+	credentials, err := as.credentials.GetCredentialsByID(ctx, userID)
+	if errors.Is(err, repository.ErrCredentialsNotFound) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %v", err)
+	}
+	if credentials.LockedUntil != nil && time.Now().Before(*credentials.LockedUntil) {
+		fmt.Printf("MFA failed: user %s is locked until %s\n", userID, credentials.LockedUntil)
+		return nil, ErrInvalidMFACode
+	}
+	return credentials, nil
+}
+
+// recordSecondFactor учитывает результат проверки кода в общем с паролями счетчике неудач.
+// Неверный код увеличивает счетчик и возвращает ErrInvalidMFACode, верный - сбрасывает счетчик.
+func (as *AuthService) recordSecondFactor(ctx context.Context, credentials *models.UserCredentials, ok bool) error {
+	if !ok {
+		fmt.Printf("MFA failed: wrong code for user %s\n", credentials.UserID)
+		err := as.credentials.RecordLoginFailure(ctx, credentials.UserID, as.loginPolicy.MaxFailedAttempts, as.loginPolicy.LockoutDuration)
+		if err != nil {
+			fmt.Printf("Failed to record login failure: %v\n", err)
+		}
+		return ErrInvalidMFACode
+	}
+
+	if credentials.FailedLogins > 0 {
+		if err := as.credentials.ResetLoginFailures(ctx, credentials.UserID); err != nil {
+			fmt.Printf("Failed to reset login failures: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// totpEnrolled проверяет, подтвердил ли пользователь TOTP
+func (as *AuthService) totpEnrolled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if as.mfa == nil {
+		return false, nil
+	}
+
+	enrollment, err := as.mfa.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get totp: %v", err)
+	}
+	return enrollment.ConfirmedAt != nil, nil
+}
+
+// issueMFAToken выдает короткоживущий токен, подтверждающий, что пароль уже проверен
+func (as *AuthService) issueMFAToken(userID uuid.UUID, scope string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(as.mfaPolicy.ChallengeTTL)
+
+	claims := &mfaClaims{
+		Scope: scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    as.policy.Issuer,
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := as.signToken(claims, jose.TypeMFAToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// parseMFAToken проверяет промежуточный токен и возвращает его claims и ID пользователя.
+// Токен погашается через useMFAToken только после верного кода, чтобы опечатка не заставляла вводить пароль заново.
+func (as *AuthService) parseMFAToken(mfaToken string) (*mfaClaims, uuid.UUID, error) {
+	claims := &mfaClaims{}
+	token, err := jwt.ParseWithClaims(mfaToken, claims, as.keyRing.Keyfunc,
+		jwt.WithValidMethods(as.signingAlgorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(as.policy.Issuer),
+		jwt.WithLeeway(as.policy.Leeway),
+	)
+	if err != nil {
+		fmt.Printf("MFA token validation failed: %v\n", err)
+		return nil, uuid.Nil, ErrInvalidMFAToken
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ != jose.TypeMFAToken {
+		return nil, uuid.Nil, ErrInvalidMFAToken
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil || claims.ID == "" {
+		return nil, uuid.Nil, ErrInvalidMFAToken
+	}
+	return claims, userID, nil
+}
+
+// useMFAToken погашает промежуточный токен: по одному паролю начинается не больше одной сессии.
+// jti помнится, пока токен еще могут принять по exp.
+func (as *AuthService) useMFAToken(ctx context.Context, claims *mfaClaims) error {
+	fresh, err := as.replay.Remember(ctx, "mfa:"+claims.ID, claims.ExpiresAt.Add(as.policy.Leeway))
+	if err != nil {
+		return fmt.Errorf("failed to check mfa token replay: %v", err)
+	}
+	if !fresh {
+		fmt.Printf("MFA token %s presented again\n", claims.ID)
+		return ErrInvalidMFAToken
+	}
+	return nil
+}
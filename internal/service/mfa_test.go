@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// fakeCredentialRepository - учетные данные в памяти со счетчиком неудач, как в таблице users
+type fakeCredentialRepository struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]*models.UserCredentials
+}
+
+func (r *fakeCredentialRepository) GetCredentials(ctx context.Context, login string) (*models.UserCredentials, error) {
+	return nil, repository.ErrCredentialsNotFound
+}
+
+func (r *fakeCredentialRepository) GetCredentialsByID(ctx context.Context, userID uuid.UUID) (*models.UserCredentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credentials, ok := r.users[userID]
+	if !ok {
+		return nil, repository.ErrCredentialsNotFound
+	}
+	stored := *credentials
+	return &stored, nil
+}
+
+func (r *fakeCredentialRepository) RecordLoginFailure(ctx context.Context, userID uuid.UUID, maxAttempts int, lockout time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credentials := r.users[userID]
+	credentials.FailedLogins++
+	if credentials.FailedLogins >= maxAttempts {
+		lockedUntil := time.Now().Add(lockout)
+		credentials.LockedUntil = &lockedUntil
+		credentials.FailedLogins = 0
+	}
+	return nil
+}
+
+func (r *fakeCredentialRepository) ResetLoginFailures(ctx context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[userID].FailedLogins = 0
+	return nil
+}
+
+// fakeMFARepository - TOTP и коды восстановления в памяти
+type fakeMFARepository struct {
+	mu            sync.Mutex
+	enrollments   map[uuid.UUID]*models.TOTPEnrollment
+	recoveryCodes map[string]bool // хэш -> еще не использован
+}
+
+func (r *fakeMFARepository) GetTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTPEnrollment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enrollment, ok := r.enrollments[userID]
+	if !ok {
+		return nil, repository.ErrMFANotEnrolled
+	}
+	stored := *enrollment
+	return &stored, nil
+}
+
+func (r *fakeMFARepository) SaveTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enrollments[userID] = &models.TOTPEnrollment{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *fakeMFARepository) ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.enrollments[userID].ConfirmedAt = &now
+	r.enrollments[userID].LastUsedStep = step
+	for _, hash := range recoveryCodeHashes {
+		r.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+func (r *fakeMFARepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enrollment := r.enrollments[userID]
+	if step <= enrollment.LastUsedStep {
+		return false, nil
+	}
+	enrollment.LastUsedStep = step
+	return true, nil
+}
+
+func (r *fakeMFARepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.recoveryCodes[codeHash] {
+		return false, nil
+	}
+	r.recoveryCodes[codeHash] = false
+	return true, nil
+}
+
+// newTestMFAService создает сервис с паролями и TOTP, блокировка после трех неудач подряд
+func newTestMFAService(t *testing.T, userID uuid.UUID) (*AuthService, *fakeCredentialRepository, *fakeMFARepository) {
+	t.Helper()
+	credentials := &fakeCredentialRepository{users: map[uuid.UUID]*models.UserCredentials{userID: {UserID: userID}}}
+	mfa := &fakeMFARepository{enrollments: make(map[uuid.UUID]*models.TOTPEnrollment), recoveryCodes: make(map[string]bool)}
+
+	as := newTestAuthService(t, newFakeTokenRepository())
+	WithCredentials(credentials, LoginPolicy{MaxFailedAttempts: 3, LockoutDuration: time.Minute})(as)
+	WithMFA(mfa, MFAPolicy{Issuer: "test", ChallengeTTL: 5 * time.Minute, RecoveryCodes: 2})(as)
+	return as, credentials, mfa
+}
+
+// currentTOTP возвращает код секрета для текущего шага
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	return hotpCode(key, totpStep(time.Now()))
+}
+
+func TestConfirmTOTPLockout(t *testing.T) {
+	userID := uuid.New()
+	as, credentials, mfa := newTestMFAService(t, userID)
+	if err := mfa.SaveTOTPSecret(context.Background(), userID, rfcTOTPSecret); err != nil {
+		t.Fatalf("SaveTOTPSecret: %v", err)
+	}
+	code := currentTOTP(t, rfcTOTPSecret)
+
+	// Неверные коды подтверждения идут в тот же счетчик, что пароли и второй шаг входа
+	for i := 0; i < 3; i++ {
+		if _, err := as.ConfirmTOTP(context.Background(), userID, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: expected ErrInvalidMFACode, got %v", i+1, err)
+		}
+	}
+	if locked := credentials.users[userID].LockedUntil; locked == nil || !locked.After(time.Now()) {
+		t.Fatal("user is not locked after failed confirmations")
+	}
+
+	// Заблокированный пользователь не подтвердит TOTP даже верным кодом
+	if _, err := as.ConfirmTOTP(context.Background(), userID, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("locked user: expected ErrInvalidMFACode, got %v", err)
+	}
+
+	credentials.users[userID].LockedUntil = nil
+	codes, err := as.ConfirmTOTP(context.Background(), userID, code)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP after lockout: %v", err)
+	}
+	if len(codes) != 2 {
+		t.Errorf("got %d recovery codes, want 2", len(codes))
+	}
+}
+
+func TestConfirmTOTPWithoutCredentials(t *testing.T) {
+	as, _, mfa := newTestMFAService(t, uuid.New())
+	other := uuid.New()
+	if err := mfa.SaveTOTPSecret(context.Background(), other, rfcTOTPSecret); err != nil {
+		t.Fatalf("SaveTOTPSecret: %v", err)
+	}
+
+	// Без пароля второй фактор не проверяется, и счетчик блокировки вести негде
+	if _, err := as.ConfirmTOTP(context.Background(), other, currentTOTP(t, rfcTOTPSecret)); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Fatalf("expected ErrMFANotEnrolled, got %v", err)
+	}
+}
+
+func TestCompleteMFALoginSingleUseToken(t *testing.T) {
+	userID := uuid.New()
+	as, _, mfa := newTestMFAService(t, userID)
+	ctx := context.Background()
+
+	if err := mfa.SaveTOTPSecret(ctx, userID, rfcTOTPSecret); err != nil {
+		t.Fatalf("SaveTOTPSecret: %v", err)
+	}
+	recoveryCodes, err := as.ConfirmTOTP(ctx, userID, currentTOTP(t, rfcTOTPSecret))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+
+	mfaToken, _, err := as.issueMFAToken(userID, "")
+	if err != nil {
+		t.Fatalf("issueMFAToken: %v", err)
+	}
+	params := MFALoginParams{MFAToken: mfaToken, RecoveryCode: "wrong-code", ClientIP: "10.0.0.1"}
+
+	// Опечатка в коде не сжигает токен
+	if _, err := as.CompleteMFALogin(ctx, params); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("wrong code: expected ErrInvalidMFACode, got %v", err)
+	}
+
+	params.RecoveryCode = recoveryCodes[0]
+	if _, err := as.CompleteMFALogin(ctx, params); err != nil {
+		t.Fatalf("CompleteMFALogin: %v", err)
+	}
+
+	// Второй сессии по тому же токену не будет даже с другим верным кодом
+	params.RecoveryCode = recoveryCodes[1]
+	if _, err := as.CompleteMFALogin(ctx, params); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Fatalf("reused mfa token: expected ErrInvalidMFAToken, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"fmt"
+	"juniortest/pkg/jose"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// WithMutualTLS сообщает, проверяет ли сервер клиентские сертификаты, к которым привязываются токены (RFC 8705).
+// Сам отпечаток сертификата передают обработчики, опция только объявляет возможность в discovery.
+func WithMutualTLS(enabled bool) Option {
+	return func(as *AuthService) {
+		as.mutualTLS = enabled
+	}
+}
+
+// confirmation собирает claim cnf из отпечатков ключа DPoP и клиентского сертификата, nil - токен не привязан
+func confirmation(jkt, x5t string) *jose.Confirmation {
+	if jkt == "" && x5t == "" {
+		return nil
+	}
+	return &jose.Confirmation{JKT: jkt, X5T: x5t}
+}
+
+// VerifyCertificateBinding проверяет, что токен, привязанный к сертификату, предъявлен по TLS с этим же сертификатом
+func (as *AuthService) VerifyCertificateBinding(claims *jose.Claims, certThumbprint string) error {
+	bound := claims.CertificateThumbprint()
+	if bound != "" && bound != certThumbprint {
+		fmt.Printf("Access token %s is bound to another client certificate\n", claims.TokenID)
+		return fmt.Errorf("%w: token is bound to another client certificate", ErrInvalidAccessToken)
+	}
+	return nil
+}
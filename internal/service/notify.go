@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/notify"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// IPChangePolicy - реакция на смену IP адреса клиента при refresh
+type IPChangePolicy string
+
+const (
+	IPChangeReject IPChangePolicy = "reject" // Отказать в обновлении
+	IPChangeWarn   IPChangePolicy = "warn"   // Обновить и отправить пользователю письмо
+	IPChangeAllow  IPChangePolicy = "allow"  // Обновить молча
+)
+
+// Сколько ждать отправки письма, чтобы зависший почтовый сервер не копил горутины
+const notifyTimeout = 30 * time.Second
+
+// EmailResolver определяет адрес почты пользователя для уведомлений, см. NewDirectoryEmailResolver
+type EmailResolver interface {
+	ResolveEmail(ctx context.Context, userID uuid.UUID) (string, error)
+}
+
+// warnIPChange в фоне отправляет пользователю письмо о смене IP адреса или устройства.
+// Ошибка отправки не влияет на уже выполненный refresh, она только пишется в лог.
+func (as *AuthService) warnIPChange(tokenData *models.RefreshTokenData, newIP, userAgent string, newDevice bool) {
+	if as.notifier == nil || as.emails == nil {
+		fmt.Printf("IP change warning skipped: notifier is not configured\n")
+		return
+	}
+
+	warning := notify.IPChangeWarning{
+		OldIP:     tokenData.ClientIP,
+		NewIP:     newIP,
+		Time:      time.Now(),
+		UserAgent: userAgent,
+		NewDevice: newDevice,
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		to, err := as.emails.ResolveEmail(ctx, tokenData.UserID)
+		if err != nil {
+			fmt.Printf("Failed to resolve email for user %s: %v\n", tokenData.UserID, err)
+			return
+		}
+		warning.To = to
+
+		msg, err := notify.RenderIPChangeWarning(warning)
+		if err != nil {
+			fmt.Printf("Failed to render IP change warning: %v\n", err)
+			return
+		}
+
+		if err := as.notifier.Notify(ctx, msg); err != nil {
+			fmt.Printf("Failed to send IP change warning to %s: %v\n", to, err)
+			return
+		}
+		fmt.Printf("IP change warning sent to %s\n", to)
+	}()
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/internal/repository"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Revoke отзывает refresh token вместе с парным access token (RFC 7009).
+// Если передан access token, отзывается выданный вместе с ним refresh token.
+// Неизвестные и уже недействительные токены не считаются ошибкой, как требует RFC 7009.
+// Токен, выданный OAuth клиенту, отзывает только этот клиент, предъявив свои учетные данные (раздел 2.1).
+func (as *AuthService) Revoke(ctx context.Context, token, clientID, clientSecret string) error {
+	// У токена client_credentials нет refresh token, он сразу заносится в denylist
+	if strings.Count(token, ".") == 2 {
+		if claims, err := as.parseAccessToken(token, true); err == nil && claims.ClientID != "" && claims.UserID == uuid.Nil {
+			if err := as.checkRevokingClient(ctx, claims.ClientID, clientID, clientSecret); err != nil {
+				return err
+			}
+			if err := as.denyTokenID(ctx, claims.TokenID.String(), claims.ExpiresAt.Time); err != nil {
+				return err
+			}
+			fmt.Printf("Revoked client access token %s\n", claims.TokenID)
+			return nil
+		}
+	}
+
+	tokenData, err := as.findTokenForRevocation(ctx, token)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) || errors.Is(err, ErrInvalidAccessToken) {
+		fmt.Printf("Nothing to revoke\n")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if tokenData.ClientID != "" {
+		if err := as.checkRevokingClient(ctx, tokenData.ClientID, clientID, clientSecret); err != nil {
+			return err
+		}
+	}
+
+	if err := as.tokenRepository.RevokeRefreshToken(ctx, tokenData.ID, models.RevokeReasonClient); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %v", err)
+	}
+
+	// Парный access token перестает работать сразу, а не по истечении срока
+	if err := as.denyAccessToken(ctx, tokenData); err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked refresh token %s\n", tokenData.ID)
+	return nil
+}
+
+// findTokenForRevocation находит строку refresh_tokens по refresh или access token
+func (as *AuthService) findTokenForRevocation(ctx context.Context, token string) (*models.RefreshTokenData, error) {
+	// Access token - это JWT. Истекший (с учетом leeway) не принимается: иначе давно утекший токен
+	// позволил бы завершить живую сессию, а владелец отзывает ее своим refresh token.
+	if strings.Count(token, ".") == 2 {
+		claims, err := as.parseAccessToken(token, true)
+		if err != nil {
+			return nil, err
+		}
+		return as.tokenRepository.GetRefreshTokenByAccessTokenID(ctx, claims.TokenID.String())
+	}
+
+	selector, verifier := splitRefreshToken(token)
+	return as.tokenRepository.GetRefreshToken(ctx, selector, verifier)
+}
+
+// checkRevokingClient аутентифицирует клиента и проверяет, что токен был выдан именно ему
+func (as *AuthService) checkRevokingClient(ctx context.Context, issuedTo, clientID, clientSecret string) error {
+	client, err := as.identifyClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	if client.ClientID != issuedTo {
+		fmt.Printf("Token issued to client %s presented for revocation by %s\n", issuedTo, client.ClientID)
+		return ErrUnauthorizedClient
+	}
+	return nil
+}
+
+// LogoutAll отзывает все живые refresh токены пользователя, а с ними и их access токены
+func (as *AuthService) LogoutAll(ctx context.Context, userID uuid.UUID, reason string) (int64, error) {
+	revoked, err := as.tokenRepository.RevokeUserRefreshTokens(ctx, userID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke user refresh tokens: %v", err)
+	}
+
+	for _, tokenData := range revoked {
+		if err := as.denyAccessToken(ctx, tokenData); err != nil {
+			return 0, err
+		}
+	}
+
+	fmt.Printf("Revoked %d refresh tokens for user %s\n", len(revoked), userID)
+	return int64(len(revoked)), nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"fmt"
+	"juniortest/internal/models"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// ScopePolicy - какие scope может получить пользователь
+type ScopePolicy struct {
+	Default []string            // Scope любого пользователя, выдаются и без явного запроса
+	Roles   map[string][]string // Дополнительные scope по ролям, выдаются только по запросу
+}
+
+// WithScopePolicy задает scope пользователей, без нее пользовательские токены выдаются без scope
+func WithScopePolicy(policy ScopePolicy) Option {
+	return func(as *AuthService) {
+		as.scopePolicy = policy
+	}
+}
+
+// userScopes возвращает scope, которые может получить пользователь с учетом его ролей.
+// Без каталога пользователей ролей нет, доступны только scope по умолчанию.
+func (as *AuthService) userScopes(user *models.User) []string {
+	scopes := append([]string(nil), as.scopePolicy.Default...)
+	if user != nil {
+		for _, role := range user.Roles {
+			scopes = append(scopes, as.scopePolicy.Roles[role]...)
+		}
+	}
+	return scopes
+}
+
+// sessionScope определяет scope новой сессии: пользователю должен быть разрешен каждый запрошенный scope,
+// а клиенту из реестра - еще и входить в его список. Без запроса выдаются scope по умолчанию.
+func (as *AuthService) sessionScope(requested string, user *models.User, client *models.OAuthClient) (string, error) {
+	allowed := as.userScopes(user)
+	defaults := as.scopePolicy.Default
+	if client != nil {
+		allowed = intersectScopes(allowed, client.Scopes)
+		defaults = intersectScopes(defaults, client.Scopes)
+	}
+	return narrowScope(requested, allowed, defaults)
+}
+
+// refreshScope определяет scope обновленной пары: запрос может только сузить scope сессии.
+// Scope, которые пользователь или клиент больше не могут получить, молча отбрасываются.
+func (as *AuthService) refreshScope(requested, current string, user *models.User, client *models.OAuthClient) (string, error) {
+	scope, err := narrowScope(requested, strings.Fields(current), strings.Fields(current))
+	if err != nil {
+		return "", err
+	}
+
+	allowed := as.userScopes(user)
+	if client != nil {
+		allowed = intersectScopes(allowed, client.Scopes)
+	}
+	return strings.Join(intersectScopes(strings.Fields(scope), allowed), " "), nil
+}
+
+// narrowScope проверяет запрошенные через пробел scope по списку разрешенных и убирает повторы.
+// Без запроса возвращаются defaults.
+func narrowScope(requested string, allowed, defaults []string) (string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(intersectScopes(defaults, defaults), " "), nil
+	}
+
+	scopes := intersectScopes(strings.Fields(requested), allowed)
+	for _, scope := range strings.Fields(requested) {
+		if !containsString(scopes, scope) {
+			fmt.Printf("Requested scope %s is not allowed\n", scope)
+			return "", ErrInvalidScope
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// intersectScopes возвращает scope из a, которые есть в b, без повторов и в порядке a
+func intersectScopes(a, b []string) []string {
+	var result []string
+	for _, scope := range a {
+		if containsString(b, scope) && !containsString(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// containsString проверяет наличие строки в списке
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
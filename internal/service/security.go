@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/models"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// recordSecurityEvent пишет событие в лог и в журнал, если он настроен.
+// Ошибка записи не прерывает основной сценарий, т.к. событие уже обработано.
+func (as *AuthService) recordSecurityEvent(ctx context.Context, event *models.SecurityEvent) {
+	fmt.Printf("SECURITY EVENT %s for user %s from %s: %s\n", event.Type, event.UserID, event.ClientIP, event.Details)
+
+	if as.securityEvents == nil {
+		return
+	}
+
+	if err := as.securityEvents.SaveSecurityEvent(ctx, event); err != nil {
+		fmt.Printf("Failed to save security event: %v\n", err)
+	}
+}
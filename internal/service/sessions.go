@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/pkg/jose"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// UserInfo возвращает сведения о владельце access token в формате OpenID Connect
+func (as *AuthService) UserInfo(ctx context.Context, claims *jose.Claims) (*models.UserInfo, error) {
+	user, err := as.checkUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &models.UserInfo{
+		Sub: claims.UserID.String(),
+		AMR: claims.AMR,
+		ACR: claims.ACR,
+	}
+
+	// Без каталога пользователей известен только ID
+	if user != nil {
+		info.PreferredUsername = user.Username
+		info.Email = user.Email
+		info.Roles = user.Roles
+	}
+	return info, nil
+}
+
+// ListSessions возвращает живые сессии пользователя, текущая определяется по паре с access token
+func (as *AuthService) ListSessions(ctx context.Context, claims *jose.Claims) ([]models.Session, error) {
+	tokens, err := as.tokenRepository.GetActiveRefreshTokens(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %v", err)
+	}
+
+	sessions := make([]models.Session, 0, len(tokens))
+	for _, tokenData := range tokens {
+		sessions = append(sessions, models.Session{
+			ID:              tokenData.FamilyID,
+			CreatedAt:       tokenData.SessionStartedAt,
+			LastRefreshedAt: tokenData.CreatedAt,
+			ExpiresAt:       tokenData.ExpiresAt,
+			ClientIP:        tokenData.ClientIP,
+			UserAgent:       tokenData.UserAgent,
+			DeviceID:        tokenData.DeviceID,
+			ClientID:        tokenData.ClientID,
+			Current:         tokenData.AccessTokenID == claims.TokenID.String(),
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает одну сессию пользователя: отзывает семейство refresh токенов и гасит их access токены.
+// Чужие и уже завершенные сессии неотличимы для вызывающего, в обоих случаях ErrSessionNotFound.
+func (as *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	tokens, err := as.tokenRepository.GetActiveRefreshTokens(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get sessions: %v", err)
+	}
+
+	owned := false
+	for _, tokenData := range tokens {
+		if tokenData.FamilyID == sessionID {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return ErrSessionNotFound
+	}
+
+	revoked, err := as.tokenRepository.RevokeFamily(ctx, sessionID, models.RevokeReasonSignOut)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+
+	for _, tokenData := range revoked {
+		if err := as.denyAccessToken(ctx, tokenData); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("User %s signed out session %s\n", userID, sessionID)
+	return nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Алгоритм подписи по умолчанию, в задании требуется SHA512
+const DefaultSigningAlgorithm = "HS512"
+
+// Минимальный размер RSA ключа, меньшие ключи считаются небезопасными
+const minRSAKeyBits = 2048
+
+// Signer подписывает access token выбранным алгоритмом и отдает ключ для проверки подписи
+type Signer interface {
+	Method() jwt.SigningMethod             // Алгоритм подписи (alg в заголовке JWT)
+	Sign(token *jwt.Token) (string, error) // Подпись токена
+	VerifyKey() interface{}                // Ключ для проверки подписи: секрет для HMAC или публичный ключ
+	PublicKey() crypto.PublicKey           // Публичный ключ для сторонних сервисов, nil для HMAC
+}
+
+// Реализация Signer поверх ключей golang-jwt
+type keySigner struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewSigner создает Signer по названию алгоритма из конфига.
+// Для HMAC используется общий секрет, для RSA, ECDSA и Ed25519 - приватный ключ из PEM файла.
+func NewSigner(algorithm string, secret []byte, privateKeyFile string) (Signer, error) {
+	if algorithm == "" {
+		algorithm = DefaultSigningAlgorithm
+	}
+
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil || algorithm == "none" {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	// HMAC не требует файла ключа, работаем с секретом
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("jwt secret key is required for %s", algorithm)
+		}
+		return &keySigner{method: method, signKey: secret, verifyKey: secret}, nil
+	}
+
+	// Для асимметричных алгоритмов читаем приватный ключ
+	if privateKeyFile == "" {
+		return nil, fmt.Errorf("private key file is required for %s", algorithm)
+	}
+
+	pemData, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	return newPEMSigner(method, pemData)
+}
+
+// newPEMSigner разбирает приватный ключ из PEM и проверяет, что он подходит к алгоритму
+func newPEMSigner(method jwt.SigningMethod, pemData []byte) (Signer, error) {
+	switch m := method.(type) {
+	// RSA-PSS проверяем первым, т.к. он встраивает SigningMethodRSA
+	case *jwt.SigningMethodRSAPSS, *jwt.SigningMethodRSA:
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return &keySigner{method: method, signKey: key, verifyKey: &key.PublicKey}, nil
+
+	case *jwt.SigningMethodECDSA:
+		key, err := jwt.ParseECPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+		if key.Curve.Params().BitSize != m.CurveBits {
+			return nil, fmt.Errorf("EC key curve %s does not match %s", key.Curve.Params().Name, m.Alg())
+		}
+		return &keySigner{method: method, signKey: key, verifyKey: &key.PublicKey}, nil
+
+	case *jwt.SigningMethodEd25519:
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Ed25519 private key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key is not an Ed25519 private key")
+		}
+		return &keySigner{method: method, signKey: edKey, verifyKey: edKey.Public()}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm: %s", method.Alg())
+}
+
+// Method возвращает алгоритм подписи
+func (s *keySigner) Method() jwt.SigningMethod {
+	return s.method
+}
+
+// Sign подписывает токен приватным ключом или секретом
+func (s *keySigner) Sign(token *jwt.Token) (string, error) {
+	return token.SignedString(s.signKey)
+}
+
+// VerifyKey возвращает ключ, которым проверяется подпись
+func (s *keySigner) VerifyKey() interface{} {
+	return s.verifyKey
+}
+
+// PublicKey возвращает публичный ключ, для HMAC его нет
+func (s *keySigner) PublicKey() crypto.PublicKey {
+	switch key := s.verifyKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key
+	}
+	return nil
+}
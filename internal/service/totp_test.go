@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Секрет "12345678901234567890" из тестовых векторов RFC 4226 и RFC 6238 в base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPCode(t *testing.T) {
+	// RFC 4226, приложение D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	secret := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotpCode(secret, int64(counter)); got != code {
+			t.Errorf("hotpCode(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		// Векторы RFC 6238 (SHA-1), последние 6 цифр
+		{"rfc 6238 t=59", rfcTOTPSecret, "287082", time.Unix(59, 0), 1, true},
+		{"rfc 6238 t=1111111109", rfcTOTPSecret, "081804", time.Unix(1111111109, 0), 37037036, true},
+		{"rfc 6238 t=1234567890", rfcTOTPSecret, "005924", time.Unix(1234567890, 0), 41152263, true},
+		{"rfc 6238 t=2000000000", rfcTOTPSecret, "279037", time.Unix(2000000000, 0), 66666666, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", time.Unix(59, 0), 1, true},
+		{"surrounding spaces", rfcTOTPSecret, " 287082 ", time.Unix(59, 0), 1, true},
+
+		// Окно ±1 шаг на расхождение часов
+		{"previous step", rfcTOTPSecret, "287082", time.Unix(89, 0), 1, true},
+		{"next step", rfcTOTPSecret, "287082", time.Unix(29, 0), 1, true},
+		{"two steps ago", rfcTOTPSecret, "287082", time.Unix(119, 0), 0, false},
+
+		{"wrong code", rfcTOTPSecret, "287083", time.Unix(59, 0), 0, false},
+		{"short code", rfcTOTPSecret, "28708", time.Unix(59, 0), 0, false},
+		{"eight digit code", rfcTOTPSecret, "94287082", time.Unix(59, 0), 0, false},
+		{"invalid secret", "not base32!", "287082", time.Unix(59, 0), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(tt.secret, tt.code, tt.now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("matchTOTP = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/internal/directory"
+	"juniortest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// WithUserDirectory задает каталог пользователей: токены выдаются только известным активным пользователям
+func WithUserDirectory(users directory.UserDirectory) Option {
+	return func(as *AuthService) {
+		as.users = users
+	}
+}
+
+// checkUser проверяет, что пользователь есть в каталоге и может получать токены.
+// Без каталога проверка пропускается и возвращается nil.
+func (as *AuthService) checkUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	if as.users == nil {
+		return nil, nil
+	}
+
+	user, err := as.users.GetUser(ctx, userID)
+	if errors.Is(err, directory.ErrUserNotFound) {
+		fmt.Printf("User %s not found in directory\n", userID)
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user from directory: %v", err)
+	}
+
+	if user.Status != models.UserStatusActive {
+		fmt.Printf("User %s is %s\n", userID, user.Status)
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
+}
+
+// Реализация EmailResolver поверх каталога пользователей
+type directoryEmailResolver struct {
+	users directory.UserDirectory
+}
+
+// NewDirectoryEmailResolver создает EmailResolver, берущий адрес из каталога пользователей
+func NewDirectoryEmailResolver(users directory.UserDirectory) EmailResolver {
+	return &directoryEmailResolver{users: users}
+}
+
+// ResolveEmail возвращает адрес пользователя из каталога
+func (r *directoryEmailResolver) ResolveEmail(ctx context.Context, userID uuid.UUID) (string, error) {
+	user, err := r.users.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.Email == "" {
+		return "", fmt.Errorf("user %s has no email", userID)
+	}
+	return user.Email, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"juniortest/internal/models"
+	"juniortest/pkg/jose"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// ValidateAccessToken проверяет подпись, издателя, сроки и аудиторию access token и возвращает его claims.
+// Принимаются только токены для аудитории самого сервиса, а также не попавшие в denylist.
+func (as *AuthService) ValidateAccessToken(ctx context.Context, accessToken string) (*jose.Claims, error) {
+	claims, err := as.validateAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !audienceMatches(claims.Audience, as.audience(nil)) {
+		fmt.Printf("Access token %s is issued for %v\n", claims.TokenID, claims.Audience)
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidAccessToken)
+	}
+	return claims, nil
+}
+
+// validateAccessToken проверяет access token как ValidateAccessToken, но с любой аудиторией.
+// Нужна introspection: решение об аудитории принимает ресурсный сервер по полю aud.
+func (as *AuthService) validateAccessToken(ctx context.Context, accessToken string) (*jose.Claims, error) {
+	claims, err := as.parseAccessToken(accessToken, true)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := as.denylist.Contains(ctx, claims.TokenID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check access token revocation: %v", err)
+	}
+	if revoked {
+		fmt.Printf("Access token %s is revoked\n", claims.TokenID)
+		return nil, fmt.Errorf("%w: token revoked", ErrInvalidAccessToken)
+	}
+
+	return claims, nil
+}
+
+// parseAccessToken проверяет подпись access token.
+// Издатель, exp, nbf и iat с допуском на расхождение часов проверяются только при verifyExpiry.
+func (as *AuthService) parseAccessToken(accessToken string, verifyExpiry bool) (*jose.Claims, error) {
+	claims := &jose.Claims{}
+
+	// Ключ выбирается по kid, алгоритм токена обязан совпадать с алгоритмом ключа
+	options := []jwt.ParserOption{jwt.WithValidMethods(as.signingAlgorithms())}
+	if verifyExpiry {
+		options = append(options,
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuer(as.policy.Issuer),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(as.policy.Leeway),
+		)
+	} else {
+		options = append(options, jwt.WithoutClaimsValidation())
+	}
+
+	token, err := jwt.ParseWithClaims(accessToken, claims, as.keyRing.Keyfunc, options...)
+	if err != nil {
+		fmt.Printf("Access token validation failed: %v\n", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+
+	// Промежуточный токен второго фактора и nonce DPoP подписаны тем же ключом, но access token не являются
+	if typ, _ := token.Header["typ"].(string); typ == jose.TypeMFAToken || typ == jose.TypeDPoPNonce {
+		return nil, fmt.Errorf("%w: unexpected token type %s", ErrInvalidAccessToken, typ)
+	}
+
+	// Библиотека проверяет nbf, только если он есть, а мы выпускаем его всегда
+	if verifyExpiry && claims.NotBefore == nil {
+		return nil, fmt.Errorf("%w: token has no nbf claim", ErrInvalidAccessToken)
+	}
+
+	return claims, nil
+}
+
+// audience возвращает аудиторию токена: аудиторию клиента или аудиторию по умолчанию
+func (as *AuthService) audience(clientAudience []string) jwt.ClaimStrings {
+	if len(clientAudience) > 0 {
+		return clientAudience
+	}
+	return as.policy.Audience
+}
+
+// audienceMatches проверяет, что токен выдан хотя бы для одной из ожидаемых аудиторий
+func audienceMatches(audience jwt.ClaimStrings, expected []string) bool {
+	for _, aud := range audience {
+		if containsString(expected, aud) {
+			return true
+		}
+	}
+	return false
+}
+
+// denyAccessToken заносит access token, выданный вместе со строкой refresh_tokens, в denylist.
+// Точный срок токена неизвестен, поэтому берется верхняя граница: момент выдачи пары плюс AccessTTL.
+func (as *AuthService) denyAccessToken(ctx context.Context, tokenData *models.RefreshTokenData) error {
+	return as.denyTokenID(ctx, tokenData.AccessTokenID, tokenData.CreatedAt.Add(as.policy.AccessTTL))
+}
+
+// denyTokenID заносит access token в denylist до момента, когда его перестанут принимать.
+// Проверка exp идет с допуском leeway, поэтому запись хранится на leeway дольше срока токена,
+// иначе отозванный токен снова заработал бы до окончания допуска.
+func (as *AuthService) denyTokenID(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if err := as.denylist.Add(ctx, tokenID, expiresAt.Add(as.policy.Leeway)); err != nil {
+		return fmt.Errorf("failed to deny access token: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+// Package authmw проверяет access токены сервиса аутентификации на стороне ресурсных сервисов.
+//
+// Пример для Gin:
+//
+//	validator, err := authmw.New(authmw.Config{
+//		Issuer:   "http://localhost:8080",
+//		Audience: []string{"http://localhost:8081"},
+//		Keys:     authmw.NewJWKS("http://localhost:8080/.well-known/jwks.json", 5*time.Minute),
+//	})
+//	router.GET("/reports", validator.Gin(), authmw.GinRequireScope("reports:read"), listReports)
+//
+// Для net/http то же самое делают validator.Middleware, RequireScope и RequireRole.
+//
+// NewJWKS работает, только если сервис публикует ключи (publish_keys с асимметричным алгоритмом).
+// Токены, подписанные HMAC (HS512 по умолчанию), проверяются через StaticKey с тем же секретом.
+//
+// Токены, привязанные к ключу DPoP (claim cnf.jkt), принимаются только со схемой Authorization: DPoP
+// и proof этого ключа в заголовке DPoP. Для защиты от повторного предъявления proof задайте Config.DPoPReplay.
+// Токены, привязанные к клиентскому сертификату (claim cnf.x5t#S256), принимаются только по TLS с этим сертификатом,
+// поэтому сервер должен проверять клиентские сертификаты, например tls.VerifyClientCertIfGiven.
+package authmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"juniortest/pkg/dpop"
+	"juniortest/pkg/jose"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Claims - claims проверенного access токена, тот же тип, которым сервис их выпускает
+type Claims = jose.Claims
+
+// Ошибки проверки токена
+var (
+	ErrMissingToken = errors.New("access token is required")
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrInvalidProof = dpop.ErrInvalidProof
+)
+
+// Насколько старым может быть DPoP proof, если Config.DPoPProofLifetime не задан
+const defaultDPoPProofLifetime = time.Minute
+
+// Denylist - список отозванных токенов по token_id, его реализуют хранилища сервиса аутентификации
+type Denylist interface {
+	Contains(ctx context.Context, tokenID string) (bool, error) // Проверка, отозван ли токен
+}
+
+// ReplayCache запоминает jti предъявленных DPoP proof, его реализуют хранилища сервиса аутентификации
+type ReplayCache interface {
+	Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error) // Запоминает ключ, false если он уже встречался
+}
+
+// Config - параметры проверки токенов
+type Config struct {
+	Issuer     string        // Ожидаемый iss, адрес сервиса аутентификации
+	Audience   []string      // Аудитории ресурсного сервиса, токен должен быть выдан хотя бы для одной
+	Keys       KeySource     // Ключи проверки подписи: StaticKey или NewJWKS
+	Algorithms []string      // Допустимые алгоритмы, пусто - любой, который разрешает ключ
+	Leeway     time.Duration // Допуск на расхождение часов при проверке exp, nbf и iat
+	Denylist   Denylist      // Необязательная проверка отзыва
+
+	DPoPReplay        ReplayCache   // Необязательная защита от повторного предъявления DPoP proof
+	DPoPProofLifetime time.Duration // Насколько старым может быть DPoP proof, по умолчанию минута
+	PublicURL         string        // Внешний адрес сервиса для проверки htu в DPoP proof, пусто - по запросу
+}
+
+// Validator проверяет access токены по Config
+type Validator struct {
+	config Config
+}
+
+// New создает Validator, издатель, аудитория и источник ключей обязательны
+func New(config Config) (*Validator, error) {
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("issuer is required")
+	}
+	if len(config.Audience) == 0 {
+		return nil, fmt.Errorf("audience is required")
+	}
+	if config.Keys == nil {
+		return nil, fmt.Errorf("key source is required")
+	}
+	if config.DPoPProofLifetime <= 0 {
+		config.DPoPProofLifetime = defaultDPoPProofLifetime
+	}
+	return &Validator{config: config}, nil
+}
+
+// Validate проверяет подпись, iss, aud, exp, nbf, iat и отзыв токена и возвращает его claims
+func (v *Validator) Validate(ctx context.Context, accessToken string) (*Claims, error) {
+	if accessToken == "" {
+		return nil, ErrMissingToken
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(v.config.Issuer),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.config.Leeway),
+	}
+	if len(v.config.Algorithms) > 0 {
+		options = append(options, jwt.WithValidMethods(v.config.Algorithms))
+	}
+
+	// Ключ выбирается по kid, источник ключей сам сверяет алгоритм токена с алгоритмом ключа
+	claims := &Claims{}
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.config.Keys.Key(ctx, kid, token.Method.Alg())
+	}
+	token, err := jwt.ParseWithClaims(accessToken, claims, keyfunc, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ == jose.TypeMFAToken || typ == jose.TypeDPoPNonce {
+		return nil, fmt.Errorf("%w: unexpected token type %s", ErrInvalidToken, typ)
+	}
+
+	// Библиотека проверяет nbf, только если он есть, а сервис выпускает его всегда
+	if claims.NotBefore == nil {
+		return nil, fmt.Errorf("%w: token has no nbf claim", ErrInvalidToken)
+	}
+
+	if !v.audienceMatches(claims.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	if v.config.Denylist != nil {
+		revoked, err := v.config.Denylist.Contains(ctx, claims.TokenID.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check access token revocation: %v", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: token revoked", ErrInvalidToken)
+		}
+	}
+
+	return claims, nil
+}
+
+// ValidateRequest проверяет токен из заголовка Authorization, а для привязанного токена еще и сертификат или DPoP proof.
+// Привязанный токен со схемой Bearer и bearer токен со схемой DPoP отклоняются (RFC 9449, раздел 7).
+func (v *Validator) ValidateRequest(r *http.Request) (*Claims, error) {
+	scheme, accessToken := authorization(r)
+	claims, err := v.Validate(r.Context(), accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Токен, привязанный к сертификату, принимается только по TLS с этим сертификатом (RFC 8705, раздел 3)
+	if x5t := claims.CertificateThumbprint(); x5t != "" && x5t != peerCertificateThumbprint(r) {
+		return nil, fmt.Errorf("%w: token is bound to another client certificate", ErrInvalidToken)
+	}
+
+	bound := claims.DPoPKey() != ""
+	if bound != strings.EqualFold(scheme, dpop.Scheme) {
+		return nil, fmt.Errorf("%w: authorization scheme %s does not match token binding", ErrInvalidToken, scheme)
+	}
+	if !bound {
+		return claims, nil
+	}
+
+	// Несколько заголовков DPoP склеиваются и не пройдут разбор: proof должен быть ровно один
+	proof, err := dpop.Verify(strings.Join(r.Header.Values(dpop.Header), ","), dpop.Request{
+		Method:      r.Method,
+		URL:         v.requestURL(r),
+		AccessToken: accessToken,
+		MaxAge:      v.config.DPoPProofLifetime,
+		Leeway:      v.config.Leeway,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if proof.JKT != claims.DPoPKey() {
+		return nil, fmt.Errorf("%w: proof key does not match token binding", ErrInvalidProof)
+	}
+
+	if v.config.DPoPReplay != nil {
+		expiresAt := proof.IssuedAt.Add(v.config.DPoPProofLifetime + v.config.Leeway)
+		fresh, err := v.config.DPoPReplay.Remember(r.Context(), proof.JKT+":"+proof.ID, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check dpop proof replay: %v", err)
+		}
+		if !fresh {
+			return nil, fmt.Errorf("%w: proof already used", ErrInvalidProof)
+		}
+	}
+
+	return claims, nil
+}
+
+// peerCertificateThumbprint возвращает x5t#S256 проверенного клиентского сертификата, пусто - соединение без него
+func peerCertificateThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return jose.CertificateThumbprint(r.TLS.PeerCertificates[0])
+}
+
+// requestURL возвращает адрес запроса для сверки с htu: от PublicURL или от Host запроса
+func (v *Validator) requestURL(r *http.Request) string {
+	if v.config.PublicURL != "" {
+		return strings.TrimSuffix(v.config.PublicURL, "/") + r.URL.Path
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// audienceMatches проверяет, что токен выдан хотя бы для одной из аудиторий сервиса
+func (v *Validator) audienceMatches(audience jwt.ClaimStrings) bool {
+	for _, aud := range audience {
+		for _, expected := range v.config.Audience {
+			if aud == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Ключ контекста для claims, отдельный тип исключает пересечения с другими пакетами
+type claimsContextKey struct{}
+
+// ContextWithClaims возвращает контекст с claims проверенного токена
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext возвращает claims, положенные в контекст middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// authorization извлекает схему и токен из заголовка Authorization: Bearer <token> или DPoP <token>
+func authorization(r *http.Request) (scheme, token string) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !(strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, dpop.Scheme)) {
+		return "", ""
+	}
+	return scheme, strings.TrimSpace(token)
+}
+
+// failure описывает ответ на неудачную проверку: статус, заголовок WWW-Authenticate (RFC 6750) и тело
+type failure struct {
+	status    int
+	challenge string
+	message   string
+}
+
+// validationFailure переводит ошибку Validate в ответ клиенту
+func validationFailure(err error) failure {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return failure{http.StatusUnauthorized, `Bearer`, "access token is required"}
+	case errors.Is(err, ErrInvalidToken):
+		return failure{http.StatusUnauthorized, `Bearer error="invalid_token"`, "invalid access token"}
+	case errors.Is(err, ErrInvalidProof):
+		challenge := fmt.Sprintf(`DPoP error="invalid_dpop_proof", algs="%s"`, strings.Join(dpop.Algorithms, " "))
+		return failure{http.StatusUnauthorized, challenge, "invalid dpop proof"}
+	default:
+		fmt.Printf("Access token validation error: %v\n", err)
+		return failure{http.StatusInternalServerError, "", "failed to validate access token"}
+	}
+}
+
+// scopeFailure - ответ на токен без нужного scope
+func scopeFailure(scope string) failure {
+	return failure{http.StatusForbidden, fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope), "insufficient scope"}
+}
+
+// roleFailure - ответ на токен без нужной роли
+func roleFailure() failure {
+	return failure{http.StatusForbidden, "", "insufficient role"}
+}
@@ -0,0 +1,528 @@
+package authmw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"juniortest/pkg/dpop"
+	"juniortest/pkg/jose"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+const (
+	testIssuer   = "http://auth.test"
+	testAudience = "http://api.test"
+	testKID      = "key-1"
+	testURL      = "http://api.test/reports"
+)
+
+// newTestKey создает ключ P-256 для подписи токенов и proof
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+// testJWK возвращает публичную часть ключа в виде JWK
+func testJWK(key *ecdsa.PrivateKey, kid string) jose.JWK {
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32))) }
+	return jose.JWK{Kty: "EC", Kid: kid, Use: "sig", Alg: "ES256", Crv: "P-256", X: encode(key.PublicKey.X), Y: encode(key.PublicKey.Y)}
+}
+
+// testClaims возвращает claims действующего access токена, mutate меняет их перед подписью
+func testClaims(mutate func(claims *Claims)) *Claims {
+	now := time.Now()
+	claims := &Claims{
+		UserID:  uuid.New(),
+		TokenID: uuid.New(),
+		Scope:   "reports:read",
+		Roles:   []string{"user"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if mutate != nil {
+		mutate(claims)
+	}
+	return claims
+}
+
+// signToken подписывает claims ключом key с заголовком kid, непустой typ заменяет стандартный
+func signToken(t *testing.T, key *ecdsa.PrivateKey, claims *Claims, typ string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = testKID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+// signProof подписывает DPoP proof ключом key для запроса method testURL и access токена
+func signProof(t *testing.T, key *ecdsa.PrivateKey, method, accessToken string) string {
+	t.Helper()
+	jwk := testJWK(key, "")
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": method,
+		"htu": testURL,
+		"iat": time.Now().Unix(),
+		"ath": dpop.AccessTokenHash(accessToken),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]interface{}{"kty": jwk.Kty, "crv": jwk.Crv, "x": jwk.X, "y": jwk.Y}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign proof: %v", err)
+	}
+	return signed
+}
+
+// thumbprint возвращает отпечаток ключа DPoP для claim cnf.jkt
+func thumbprint(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	jkt, err := testJWK(key, "").Thumbprint()
+	if err != nil {
+		t.Fatalf("thumbprint: %v", err)
+	}
+	return jkt
+}
+
+// newTestValidator создает Validator с локальным ключом проверки и допуском 30 секунд
+func newTestValidator(t *testing.T, key *ecdsa.PrivateKey, mutate func(config *Config)) *Validator {
+	t.Helper()
+	config := Config{
+		Issuer:   testIssuer,
+		Audience: []string{testAudience},
+		Keys:     StaticKey("ES256", &key.PublicKey),
+		Leeway:   30 * time.Second,
+	}
+	if mutate != nil {
+		mutate(&config)
+	}
+	validator, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return validator
+}
+
+// fakeDenylist - denylist в памяти, err имитирует недоступное хранилище
+type fakeDenylist struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (d *fakeDenylist) Contains(ctx context.Context, tokenID string) (bool, error) {
+	return d.revoked[tokenID], d.err
+}
+
+// fakeReplayCache запоминает ключи в памяти
+type fakeReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (c *fakeReplayCache) Remember(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[key] {
+		return false, nil
+	}
+	c.seen[key] = true
+	return true, nil
+}
+
+func TestNew(t *testing.T) {
+	keys := StaticKey("ES256", nil)
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"complete", Config{Issuer: testIssuer, Audience: []string{testAudience}, Keys: keys}, false},
+		{"no issuer", Config{Audience: []string{testAudience}, Keys: keys}, true},
+		{"no audience", Config{Issuer: testIssuer, Keys: keys}, true},
+		{"no keys", Config{Issuer: testIssuer, Audience: []string{testAudience}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("New error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+	revoked := testClaims(nil)
+
+	tests := []struct {
+		name     string
+		token    func(t *testing.T) string
+		denylist *fakeDenylist
+		wantErr  error // nil - токен принимается
+	}{
+		{
+			name:  "valid token",
+			token: func(t *testing.T) string { return signToken(t, key, testClaims(nil), "") },
+		},
+		{
+			name:    "missing token",
+			token:   func(t *testing.T) string { return "" },
+			wantErr: ErrMissingToken,
+		},
+		{
+			name:    "malformed token",
+			token:   func(t *testing.T) string { return "not.a.token" },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "signed by another key",
+			token:   func(t *testing.T) string { return signToken(t, otherKey, testClaims(nil), "") },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "symmetric algorithm",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims(nil)).SignedString([]byte("secret"))
+				if err != nil {
+					t.Fatalf("sign: %v", err)
+				}
+				return signed
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "another issuer",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.Issuer = "http://evil.test" }), "")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "another audience",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"http://other.test"} }), "")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "one of several audiences",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"http://other.test", testAudience} }), "")
+			},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }), "")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "expired within leeway",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second)) }), "")
+			},
+		},
+		{
+			name: "no exp",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.ExpiresAt = nil }), "")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "no nbf",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.NotBefore = nil }), "")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "not yet valid",
+			token: func(t *testing.T) string {
+				return signToken(t, key, testClaims(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }), "")
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "mfa token",
+			token:   func(t *testing.T) string { return signToken(t, key, testClaims(nil), jose.TypeMFAToken) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "dpop nonce",
+			token:   func(t *testing.T) string { return signToken(t, key, testClaims(nil), jose.TypeDPoPNonce) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:     "revoked",
+			token:    func(t *testing.T) string { return signToken(t, key, revoked, "") },
+			denylist: &fakeDenylist{revoked: map[string]bool{revoked.TokenID.String(): true}},
+			wantErr:  ErrInvalidToken,
+		},
+		{
+			name:     "not revoked",
+			token:    func(t *testing.T) string { return signToken(t, key, testClaims(nil), "") },
+			denylist: &fakeDenylist{revoked: map[string]bool{revoked.TokenID.String(): true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newTestValidator(t, key, func(config *Config) {
+				if tt.denylist != nil {
+					config.Denylist = tt.denylist
+				}
+			})
+
+			claims, err := validator.Validate(context.Background(), tt.token(t))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims.Issuer != testIssuer {
+					t.Errorf("claims.Issuer = %q", claims.Issuer)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateDenylistFailure(t *testing.T) {
+	key := newTestKey(t)
+	validator := newTestValidator(t, key, func(config *Config) {
+		config.Denylist = &fakeDenylist{err: errors.New("connection refused")}
+	})
+
+	// Недоступное хранилище - ошибка сервиса, а не недействительный токен
+	_, err := validator.Validate(context.Background(), signToken(t, key, testClaims(nil), ""))
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected storage error, got %v", err)
+	}
+	if f := validationFailure(err); f.status != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", f.status)
+	}
+}
+
+// newTestCertificate создает самоподписанный клиентский сертификат
+func newTestCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	key := newTestKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestValidateRequest(t *testing.T) {
+	key := newTestKey(t)
+	dpopKey := newTestKey(t)
+	otherDPoPKey := newTestKey(t)
+	cert := newTestCertificate(t)
+	otherCert := newTestCertificate(t)
+
+	bearer := signToken(t, key, testClaims(nil), "")
+	dpopBound := signToken(t, key, testClaims(func(c *Claims) {
+		c.Cnf = &jose.Confirmation{JKT: thumbprint(t, dpopKey)}
+	}), "")
+	certBound := signToken(t, key, testClaims(func(c *Claims) {
+		c.Cnf = &jose.Confirmation{X5T: jose.CertificateThumbprint(cert)}
+	}), "")
+
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		proof         func(t *testing.T) string
+		tls           *tls.ConnectionState
+		wantErr       error
+	}{
+		{name: "bearer token", authorization: "Bearer " + bearer},
+		{name: "lowercase scheme", authorization: "bearer " + bearer},
+		{name: "no authorization", wantErr: ErrMissingToken},
+		{name: "unknown scheme", authorization: "Basic " + bearer, wantErr: ErrMissingToken},
+		{name: "bearer token with dpop scheme", authorization: "DPoP " + bearer, wantErr: ErrInvalidToken},
+		{name: "dpop bound token with bearer scheme", authorization: "Bearer " + dpopBound, wantErr: ErrInvalidToken},
+		{
+			name:          "dpop bound token with proof",
+			authorization: "DPoP " + dpopBound,
+			proof:         func(t *testing.T) string { return signProof(t, dpopKey, http.MethodGet, dpopBound) },
+		},
+		{
+			name:          "dpop bound token without proof",
+			authorization: "DPoP " + dpopBound,
+			wantErr:       ErrInvalidProof,
+		},
+		{
+			name:          "proof of another key",
+			authorization: "DPoP " + dpopBound,
+			proof:         func(t *testing.T) string { return signProof(t, otherDPoPKey, http.MethodGet, dpopBound) },
+			wantErr:       ErrInvalidProof,
+		},
+		{
+			name:          "proof for another method",
+			authorization: "DPoP " + dpopBound,
+			proof:         func(t *testing.T) string { return signProof(t, dpopKey, http.MethodPost, dpopBound) },
+			wantErr:       ErrInvalidProof,
+		},
+		{
+			name:          "proof for another token",
+			authorization: "DPoP " + dpopBound,
+			proof:         func(t *testing.T) string { return signProof(t, dpopKey, http.MethodGet, bearer) },
+			wantErr:       ErrInvalidProof,
+		},
+		{
+			name:          "certificate bound token with its certificate",
+			authorization: "Bearer " + certBound,
+			tls:           verified(cert),
+		},
+		{
+			name:          "certificate bound token without tls",
+			authorization: "Bearer " + certBound,
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name:          "certificate bound token with another certificate",
+			authorization: "Bearer " + certBound,
+			tls:           verified(otherCert),
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name:          "certificate bound token with unverified certificate",
+			authorization: "Bearer " + certBound,
+			tls:           &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+			wantErr:       ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newTestValidator(t, key, func(config *Config) { config.PublicURL = "http://api.test" })
+
+			r := httptest.NewRequest(http.MethodGet, testURL, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.proof != nil {
+				r.Header.Set(dpop.Header, tt.proof(t))
+			}
+			r.TLS = tt.tls
+
+			_, err := validator.ValidateRequest(r)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateRequestProofReplay(t *testing.T) {
+	key := newTestKey(t)
+	dpopKey := newTestKey(t)
+	accessToken := signToken(t, key, testClaims(func(c *Claims) {
+		c.Cnf = &jose.Confirmation{JKT: thumbprint(t, dpopKey)}
+	}), "")
+	validator := newTestValidator(t, key, func(config *Config) {
+		config.DPoPReplay = &fakeReplayCache{seen: make(map[string]bool)}
+	})
+
+	proof := signProof(t, dpopKey, http.MethodGet, accessToken)
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, testURL, nil)
+		r.Header.Set("Authorization", "DPoP "+accessToken)
+		r.Header.Set(dpop.Header, proof)
+		return r
+	}
+
+	if _, err := validator.ValidateRequest(request()); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := validator.ValidateRequest(request()); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("replayed proof: expected ErrInvalidProof, got %v", err)
+	}
+}
+
+func TestValidationFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantStatus    int
+		wantChallenge string // Начало заголовка WWW-Authenticate, пусто - заголовка нет
+	}{
+		{"missing token", ErrMissingToken, http.StatusUnauthorized, "Bearer"},
+		{"invalid token", ErrInvalidToken, http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"wrapped invalid token", errors.Join(errors.New("expired"), ErrInvalidToken), http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"invalid proof", ErrInvalidProof, http.StatusUnauthorized, `DPoP error="invalid_dpop_proof", algs="`},
+		{"storage failure", errors.New("connection refused"), http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := validationFailure(tt.err)
+			if f.status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", f.status, tt.wantStatus)
+			}
+			if !strings.HasPrefix(f.challenge, tt.wantChallenge) || (tt.wantChallenge == "") != (f.challenge == "") {
+				t.Errorf("challenge = %q, want prefix %q", f.challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package authmw
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Gin - middleware для Gin, проверяет access токен, для привязанных к DPoP - и proof, и кладет claims в контекст запроса.
+// Claims доступны через GinClaims(c) или ClaimsFromContext(c.Request.Context()).
+func (v *Validator) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.ValidateRequest(c.Request)
+		if err != nil {
+			abortWithFailure(c, validationFailure(err))
+			return
+		}
+		c.Request = c.Request.WithContext(ContextWithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// GinClaims возвращает claims, положенные middleware Gin
+func GinClaims(c *gin.Context) (*Claims, bool) {
+	return ClaimsFromContext(c.Request.Context())
+}
+
+// GinRequireScope пропускает только запросы с токеном, которому выдан scope. Ставится после Gin.
+func GinRequireScope(scope string) gin.HandlerFunc {
+	return ginRequire(func(claims *Claims) (failure, bool) {
+		return scopeFailure(scope), claims.HasScope(scope)
+	})
+}
+
+// GinRequireRole пропускает только запросы пользователей с ролью. Ставится после Gin.
+func GinRequireRole(role string) gin.HandlerFunc {
+	return ginRequire(func(claims *Claims) (failure, bool) {
+		return roleFailure(), claims.HasRole(role)
+	})
+}
+
+// ginRequire собирает middleware Gin из проверки claims
+func ginRequire(check func(*Claims) (failure, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GinClaims(c)
+		if !ok {
+			abortWithFailure(c, validationFailure(ErrMissingToken))
+			return
+		}
+		if f, ok := check(claims); !ok {
+			abortWithFailure(c, f)
+			return
+		}
+		c.Next()
+	}
+}
+
+// abortWithFailure прерывает цепочку обработчиков и отвечает клиенту ошибкой
+func abortWithFailure(c *gin.Context, f failure) {
+	if f.challenge != "" {
+		c.Header("WWW-Authenticate", f.challenge)
+	}
+	c.AbortWithStatusJSON(f.status, gin.H{"error": f.message})
+}
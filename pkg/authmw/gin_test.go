@@ -0,0 +1,51 @@
+package authmw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, tests := adapterCases(t)
+	validator := newTestValidator(t, key, nil)
+
+	router := gin.New()
+	router.GET("/reports", validator.Gin(), GinRequireScope("reports:read"), GinRequireRole("user"), func(c *gin.Context) {
+		if _, ok := GinClaims(c); !ok {
+			t.Error("handler called without claims")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, testURL, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, r)
+			checkAdapterResponse(t, tt, rec)
+		})
+	}
+}
+
+func TestGinRequireRoleWithoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/reports", GinRequireRole("user"), func(c *gin.Context) {
+		t.Error("handler called without claims")
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, testURL, nil))
+	checkAdapterResponse(t, adapterCase{wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer", wantError: "access token is required"}, rec)
+}
@@ -0,0 +1,64 @@
+package authmw
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Middleware проверяет access токен, для привязанных к DPoP - и proof, и кладет claims в контекст запроса (см. ClaimsFromContext)
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.ValidateRequest(r)
+		if err != nil {
+			writeFailure(w, validationFailure(err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+// RequireScope пропускает только запросы с токеном, которому выдан scope. Ставится после Middleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return require(func(claims *Claims) (failure, bool) {
+		return scopeFailure(scope), claims.HasScope(scope)
+	})
+}
+
+// RequireRole пропускает только запросы пользователей с ролью. Ставится после Middleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return require(func(claims *Claims) (failure, bool) {
+		return roleFailure(), claims.HasRole(role)
+	})
+}
+
+// require собирает middleware из проверки claims
+func require(check func(*Claims) (failure, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeFailure(w, validationFailure(ErrMissingToken))
+				return
+			}
+			if f, ok := check(claims); !ok {
+				writeFailure(w, f)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeFailure отвечает клиенту ошибкой в том же формате, что и сервис аутентификации
+func writeFailure(w http.ResponseWriter, f failure) {
+	if f.challenge != "" {
+		w.Header().Set("WWW-Authenticate", f.challenge)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(f.status)
+	json.NewEncoder(w).Encode(map[string]string{"error": f.message})
+}
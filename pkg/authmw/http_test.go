@@ -0,0 +1,116 @@
+package authmw
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// adapterCase - запрос к защищенному маршруту и ожидаемый ответ, общий для net/http и Gin
+type adapterCase struct {
+	name          string
+	authorization string
+	wantStatus    int
+	wantChallenge string
+	wantError     string
+}
+
+// adapterCases возвращает ключ подписи и случаи для маршрута, требующего scope reports:read и роль user
+func adapterCases(t *testing.T) (*ecdsa.PrivateKey, []adapterCase) {
+	t.Helper()
+	key := newTestKey(t)
+
+	return key, []adapterCase{
+		{
+			name:          "allowed",
+			authorization: "Bearer " + signToken(t, key, testClaims(nil), ""),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "no token",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+			wantError:     "access token is required",
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer " + signToken(t, newTestKey(t), testClaims(nil), ""),
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token"`,
+			wantError:     "invalid access token",
+		},
+		{
+			name:          "insufficient scope",
+			authorization: "Bearer " + signToken(t, key, testClaims(func(c *Claims) { c.Scope = "reports:write" }), ""),
+			wantStatus:    http.StatusForbidden,
+			wantChallenge: `Bearer error="insufficient_scope", scope="reports:read"`,
+			wantError:     "insufficient scope",
+		},
+		{
+			name:          "insufficient role",
+			authorization: "Bearer " + signToken(t, key, testClaims(func(c *Claims) { c.Roles = []string{"guest"} }), ""),
+			wantStatus:    http.StatusForbidden,
+			wantError:     "insufficient role",
+		},
+	}
+}
+
+// checkAdapterResponse сверяет код ответа, заголовок WWW-Authenticate и текст ошибки
+func checkAdapterResponse(t *testing.T, tt adapterCase, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	if rec.Code != tt.wantStatus {
+		t.Fatalf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body.String())
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+		t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+	}
+	if tt.wantStatus == http.StatusOK {
+		return
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body["error"] != tt.wantError {
+		t.Errorf("error = %q, want %q", body["error"], tt.wantError)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	key, tests := adapterCases(t)
+	validator := newTestValidator(t, key, nil)
+	handler := validator.Middleware(RequireScope("reports:read")(RequireRole("user")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ClaimsFromContext(r.Context()); !ok {
+			t.Error("handler called without claims")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, testURL, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			checkAdapterResponse(t, tt, rec)
+		})
+	}
+}
+
+func TestRequireScopeWithoutMiddleware(t *testing.T) {
+	handler := RequireScope("reports:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without claims")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, testURL, nil))
+	checkAdapterResponse(t, adapterCase{wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer", wantError: "access token is required"}, rec)
+}
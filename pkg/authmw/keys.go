@@ -0,0 +1,192 @@
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"juniortest/pkg/jose"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Не чаще этого JWKS перекачивается, чтобы поддельные токены или недоступный сервис ключей
+// не превращали каждый запрос в обращение к нему
+const jwksMinRefreshInterval = 10 * time.Second
+
+// KeySource возвращает ключ проверки подписи по kid и алгоритму из заголовка токена
+type KeySource interface {
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// Локальный ключ: секрет HMAC ([]byte) или публичный ключ RSA, ECDSA, Ed25519
+type staticKey struct {
+	alg string
+	key interface{}
+}
+
+// StaticKey задает один локальный ключ для алгоритма alg, kid токена не проверяется
+func StaticKey(alg string, key interface{}) KeySource {
+	return &staticKey{alg: alg, key: key}
+}
+
+// Key возвращает локальный ключ, если алгоритм токена совпадает с алгоритмом ключа
+func (k *staticKey) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	if alg != k.alg {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+	return k.key, nil
+}
+
+// Ключ из JWKS вместе с его алгоритмом
+type jwksKey struct {
+	alg string
+	key interface{}
+}
+
+// JWKS - ключи из JWK Set сервиса аутентификации с кэшированием.
+// Набор перекачивается по истечении ttl в фоне, а также при встрече незнакомого kid после ротации ключей.
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	fetchMu     sync.Mutex // Одна загрузка за раз, остальные запросы ждут ее результата
+	mu          sync.RWMutex
+	keys        map[string]jwksKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKS создает источник ключей по адресу /.well-known/jwks.json
+func NewJWKS(url string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Key возвращает ключ по kid, при необходимости обновляя кэш
+func (j *JWKS) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+
+	key, found, fresh := j.cached(kid)
+	switch {
+	case found && !fresh:
+		// Известный ключ отдаем из устаревшего набора сразу, чтобы запрос не ждал сервис ключей
+		j.refreshInBackground()
+	case !found:
+		if err := j.refresh(ctx, false); err != nil {
+			return nil, err
+		}
+		if key, found, _ = j.cached(kid); !found {
+			return nil, fmt.Errorf("unknown signing key id: %s", kid)
+		}
+	}
+
+	if key.alg != alg {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+	return key.key, nil
+}
+
+// cached ищет ключ в кэше и сообщает, не устарел ли набор
+func (j *JWKS) cached(kid string) (jwksKey, bool, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	key, found := j.keys[kid]
+	return key, found, time.Since(j.fetchedAt) < j.ttl
+}
+
+// refreshInBackground обновляет устаревший набор в отдельной горутине, если загрузка еще не идет
+func (j *JWKS) refreshInBackground() {
+	if !j.fetchMu.TryLock() {
+		return
+	}
+	go func() {
+		defer j.fetchMu.Unlock()
+		if err := j.refreshLocked(context.Background(), true); err != nil {
+			fmt.Printf("Failed to refresh JWKS, using cached keys: %v\n", err)
+		}
+	}()
+}
+
+// refresh загружает набор ключей, дожидаясь параллельной загрузки
+func (j *JWKS) refresh(ctx context.Context, known bool) error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+	return j.refreshLocked(ctx, known)
+}
+
+// refreshLocked загружает набор ключей под fetchMu. Загрузка выполняется не чаще jwksMinRefreshInterval,
+// в том числе после неудачной попытки, а ради известного ключа (known=true) - только если набор устарел.
+func (j *JWKS) refreshLocked(ctx context.Context, known bool) error {
+	// Пока ждали блокировку, набор мог обновить параллельный запрос
+	j.mu.RLock()
+	fresh := time.Since(j.fetchedAt) < j.ttl
+	recent := time.Since(j.lastAttempt) < jwksMinRefreshInterval
+	j.mu.RUnlock()
+	if recent || (known && fresh) {
+		return nil
+	}
+
+	j.mu.Lock()
+	j.lastAttempt = time.Now()
+	j.mu.Unlock()
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+// fetch скачивает и разбирает JWK Set, ключи других назначений и неподдерживаемых типов пропускаются
+func (j *JWKS) fetch(ctx context.Context) (map[string]jwksKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwks request: %v", err)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks endpoint returned status %d", resp.StatusCode)
+	}
+
+	var set jose.JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %v", err)
+	}
+
+	keys := make(map[string]jwksKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" || jwk.Alg == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			fmt.Printf("Skipping JWK %s: %v\n", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = jwksKey{alg: jwk.Alg, key: key}
+	}
+	return keys, nil
+}
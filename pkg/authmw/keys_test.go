@@ -0,0 +1,225 @@
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"juniortest/pkg/jose"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// jwksServer - тестовый сервис ключей, считает обращения и умеет отвечать ошибкой
+type jwksServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	set    jose.JWKSet
+	status int
+	hits   atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...jose.JWK) *jwksServer {
+	t.Helper()
+	s := &jwksServer{set: jose.JWKSet{Keys: keys}, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		json.NewEncoder(w).Encode(s.set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// publish заменяет набор ключей и код ответа
+func (s *jwksServer) publish(status int, keys ...jose.JWK) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.set = jose.JWKSet{Keys: keys}
+}
+
+// age сдвигает время последней загрузки и попытки назад, имитируя прошедшее время
+func (j *JWKS) age(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetchedAt = j.fetchedAt.Add(-d)
+	j.lastAttempt = j.lastAttempt.Add(-d)
+}
+
+// waitRefresh дожидается окончания фоновой загрузки
+func (j *JWKS) waitRefresh() {
+	j.fetchMu.Lock()
+	j.fetchMu.Unlock()
+}
+
+func TestJWKSKey(t *testing.T) {
+	key := newTestKey(t)
+	encryption := testJWK(newTestKey(t), "enc-1")
+	encryption.Use = "enc"
+	noAlg := testJWK(newTestKey(t), "no-alg")
+	noAlg.Alg = ""
+	server := newJWKSServer(t, testJWK(key, testKID), encryption, noAlg)
+
+	tests := []struct {
+		name    string
+		kid     string
+		alg     string
+		wantErr bool
+	}{
+		{name: "known key", kid: testKID, alg: "ES256"},
+		{name: "no kid", kid: "", alg: "ES256", wantErr: true},
+		{name: "algorithm mismatch", kid: testKID, alg: "RS256", wantErr: true},
+		{name: "unknown kid", kid: "key-2", alg: "ES256", wantErr: true},
+		{name: "encryption key", kid: "enc-1", alg: "ES256", wantErr: true},
+		{name: "key without alg", kid: "no-alg", alg: "ES256", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwks := NewJWKS(server.URL, time.Minute)
+			got, err := jwks.Key(context.Background(), tt.kid, tt.alg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got key %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !key.PublicKey.Equal(got) {
+				t.Errorf("got another key")
+			}
+		})
+	}
+}
+
+func TestJWKSCache(t *testing.T) {
+	key := newTestKey(t)
+	server := newJWKSServer(t, testJWK(key, testKID))
+	jwks := NewJWKS(server.URL, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := jwks.Key(ctx, testKID, "ES256"); err != nil {
+			t.Fatalf("Key: %v", err)
+		}
+	}
+	if hits := server.hits.Load(); hits != 1 {
+		t.Fatalf("expected one fetch while the set is fresh, got %d", hits)
+	}
+
+	// Незнакомые kid сразу после загрузки не вызывают новых обращений к сервису ключей
+	for i := 0; i < 3; i++ {
+		if _, err := jwks.Key(ctx, "forged", "ES256"); err == nil {
+			t.Fatal("expected error for unknown kid")
+		}
+	}
+	if hits := server.hits.Load(); hits != 1 {
+		t.Fatalf("expected no fetches within the backoff interval, got %d", hits)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey := newTestKey(t)
+	newKey := newTestKey(t)
+	server := newJWKSServer(t, testJWK(oldKey, "old"))
+	jwks := NewJWKS(server.URL, time.Minute)
+	ctx := context.Background()
+
+	if _, err := jwks.Key(ctx, "old", "ES256"); err != nil {
+		t.Fatalf("Key old: %v", err)
+	}
+
+	// После ротации незнакомый kid загружает набор заново, как только прошел интервал
+	server.publish(http.StatusOK, testJWK(oldKey, "old"), testJWK(newKey, "new"))
+	jwks.age(jwksMinRefreshInterval)
+
+	got, err := jwks.Key(ctx, "new", "ES256")
+	if err != nil {
+		t.Fatalf("Key new: %v", err)
+	}
+	if !newKey.PublicKey.Equal(got) {
+		t.Errorf("got another key")
+	}
+	if hits := server.hits.Load(); hits != 2 {
+		t.Fatalf("expected 2 fetches, got %d", hits)
+	}
+}
+
+func TestJWKSBackgroundRefresh(t *testing.T) {
+	oldKey := newTestKey(t)
+	newKey := newTestKey(t)
+	server := newJWKSServer(t, testJWK(oldKey, "old"))
+	jwks := NewJWKS(server.URL, time.Minute)
+	ctx := context.Background()
+
+	if _, err := jwks.Key(ctx, "old", "ES256"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	// Устаревший набор при недоступном сервисе: ключ отдается из кэша, загрузка идет в фоне
+	server.publish(http.StatusServiceUnavailable)
+	jwks.age(time.Minute)
+
+	got, err := jwks.Key(ctx, "old", "ES256")
+	if err != nil {
+		t.Fatalf("Key with stale set: %v", err)
+	}
+	if !oldKey.PublicKey.Equal(got) {
+		t.Errorf("got another key")
+	}
+	jwks.waitRefresh()
+	if hits := server.hits.Load(); hits != 2 {
+		t.Fatalf("expected background fetch, got %d fetches", hits)
+	}
+
+	// После неудачи следующая попытка откладывается на интервал, кэш продолжает работать
+	if _, err := jwks.Key(ctx, "old", "ES256"); err != nil {
+		t.Fatalf("Key after failed refresh: %v", err)
+	}
+	jwks.waitRefresh()
+	if hits := server.hits.Load(); hits != 2 {
+		t.Fatalf("expected no fetch within the backoff interval, got %d", hits)
+	}
+
+	// По прошествии интервала фоновая загрузка подхватывает новый набор
+	server.publish(http.StatusOK, testJWK(newKey, "new"))
+	jwks.age(jwksMinRefreshInterval)
+
+	if _, err := jwks.Key(ctx, "old", "ES256"); err != nil {
+		t.Fatalf("Key before refresh: %v", err)
+	}
+	jwks.waitRefresh()
+	if hits := server.hits.Load(); hits != 3 {
+		t.Fatalf("expected 3 fetches, got %d", hits)
+	}
+	if _, err := jwks.Key(ctx, "old", "ES256"); err == nil {
+		t.Fatal("expected removed key to be rejected after refresh")
+	}
+	if _, err := jwks.Key(ctx, "new", "ES256"); err != nil {
+		t.Fatalf("Key new: %v", err)
+	}
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	server := newJWKSServer(t)
+	server.publish(http.StatusInternalServerError)
+	jwks := NewJWKS(server.URL, time.Minute)
+
+	if _, err := jwks.Key(context.Background(), testKID, "ES256"); err == nil {
+		t.Fatal("expected error when jwks endpoint fails")
+	}
+}
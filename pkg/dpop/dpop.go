@@ -0,0 +1,179 @@
+// Package dpop проверяет DPoP proof (RFC 9449) - JWT, которым клиент доказывает владение ключом,
+// к которому привязаны его токены. Пакет общий для сервиса аутентификации и ресурсных сервисов (см. authmw).
+// Nonce и защиту от повторного предъявления proof проверяет вызывающая сторона.
+package dpop
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"juniortest/pkg/jose"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Заголовки и схема авторизации из RFC 9449
+const (
+	Header      = "DPoP"       // Заголовок запроса с proof
+	NonceHeader = "DPoP-Nonce" // Заголовок ответа, в котором сервер выдает nonce
+	Scheme      = "DPoP"       // Схема Authorization и token_type для привязанных токенов
+	proofType   = "dpop+jwt"   // Обязательный typ в заголовке proof
+)
+
+// ErrInvalidProof - proof отсутствует, подделан, устарел или выдан для другого запроса
+var ErrInvalidProof = errors.New("invalid dpop proof")
+
+// Algorithms - допустимые алгоритмы подписи proof.
+// Только асимметричные: HMAC и none не доказывают владение ключом из заголовка jwk.
+var Algorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Request - что ожидается от proof для конкретного HTTP запроса
+type Request struct {
+	Method      string        // Метод запроса, claim htm
+	URL         string        // Адрес запроса без query и fragment, claim htu
+	AccessToken string        // Предъявленный access token, если задан - proof обязан содержать его хэш в ath
+	MaxAge      time.Duration // Насколько старым может быть iat
+	Leeway      time.Duration // Допуск на расхождение часов
+}
+
+// Proof - проверенный proof
+type Proof struct {
+	ID       string    // jti, по нему отсекаются повторы
+	JKT      string    // Отпечаток публичного ключа (RFC 7638), к нему привязываются токены
+	Nonce    string    // nonce сервера, если клиент его передал
+	IssuedAt time.Time // Момент создания proof
+}
+
+// Claims proof, кроме jti и iat все поля из RFC 9449
+type proofClaims struct {
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	Nonce string `json:"nonce,omitempty"`
+	ATH   string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Verify проверяет подпись proof ключом из его заголовка jwk, typ, htm, htu, iat и ath
+func Verify(proof string, req Request) (*Proof, error) {
+	if proof == "" {
+		return nil, fmt.Errorf("%w: proof is required", ErrInvalidProof)
+	}
+
+	// Ключ проверки приходит в самом proof, его отпечаток запоминается для привязки токенов
+	var jkt string
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, fmt.Errorf("unexpected token type %q", typ)
+		}
+		jwk, err := headerJWK(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		if jkt, err = jwk.Thumbprint(); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	claims := &proofClaims{}
+	if _, err := jwt.ParseWithClaims(proof, claims, keyfunc,
+		jwt.WithValidMethods(Algorithms),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(req.Leeway),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: jti and iat are required", ErrInvalidProof)
+	}
+	if claims.IssuedAt.Before(time.Now().Add(-req.MaxAge - req.Leeway)) {
+		return nil, fmt.Errorf("%w: proof is too old", ErrInvalidProof)
+	}
+	if claims.HTM != req.Method {
+		return nil, fmt.Errorf("%w: htm does not match request method", ErrInvalidProof)
+	}
+	if !sameURL(claims.HTU, req.URL) {
+		return nil, fmt.Errorf("%w: htu does not match request url", ErrInvalidProof)
+	}
+	if req.AccessToken != "" && claims.ATH != AccessTokenHash(req.AccessToken) {
+		return nil, fmt.Errorf("%w: ath does not match access token", ErrInvalidProof)
+	}
+
+	return &Proof{
+		ID:       claims.ID,
+		JKT:      jkt,
+		Nonce:    claims.Nonce,
+		IssuedAt: claims.IssuedAt.Time,
+	}, nil
+}
+
+// AccessTokenHash считает ath: base64url от SHA-256 access токена
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// headerJWK достает публичный ключ из заголовка jwk, закрытый ключ в proof - ошибка клиента
+func headerJWK(value interface{}) (jose.JWK, error) {
+	raw, ok := value.(map[string]interface{})
+	if !ok {
+		return jose.JWK{}, fmt.Errorf("jwk header is required")
+	}
+	if _, private := raw["d"]; private {
+		return jose.JWK{}, fmt.Errorf("jwk header must not contain a private key")
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return jose.JWK{}, fmt.Errorf("invalid jwk header: %v", err)
+	}
+	var jwk jose.JWK
+	if err := json.Unmarshal(b, &jwk); err != nil {
+		return jose.JWK{}, fmt.Errorf("invalid jwk header: %v", err)
+	}
+	return jwk, nil
+}
+
+// sameURL сравнивает htu с адресом запроса: схема и хост без учета регистра и порта по умолчанию, query и fragment отбрасываются
+func sameURL(htu, expected string) bool {
+	a, okA := normalizeURL(htu)
+	b, okB := normalizeURL(expected)
+	return okA && okB && a == b
+}
+
+// normalizeURL приводит адрес к виду для сравнения по RFC 9449 (раздел 4.3)
+func normalizeURL(value string) (string, bool) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" || strings.Contains(host, ":") {
+		host = strings.TrimSuffix(net.JoinHostPort(host, port), ":")
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path, true
+}
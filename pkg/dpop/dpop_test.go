@@ -0,0 +1,257 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"juniortest/pkg/jose"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+const (
+	testURL         = "https://auth.example.com/token"
+	testAccessToken = "access-token"
+)
+
+// testJWK возвращает публичную часть ключа P-256 в виде заголовка jwk
+func testJWK(key *ecdsa.PrivateKey) map[string]interface{} {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   encode(key.PublicKey.X.FillBytes(make([]byte, 32))),
+		"y":   encode(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// testProof подписывает proof ключом key, mutate меняет заголовок и claims перед подписью
+func testProof(t *testing.T, key *ecdsa.PrivateKey, mutate func(header map[string]interface{}, claims jwt.MapClaims)) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"jti": "proof-1",
+		"htm": "POST",
+		"htu": testURL,
+		"iat": time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = testJWK(key)
+	if mutate != nil {
+		mutate(token.Header, claims)
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign proof: %v", err)
+	}
+	return signed
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+
+	request := Request{Method: "POST", URL: testURL, MaxAge: time.Minute, Leeway: 5 * time.Second}
+	withAccessToken := request
+	withAccessToken.AccessToken = testAccessToken
+
+	tests := []struct {
+		name    string
+		proof   func(t *testing.T) string
+		request Request
+		wantErr bool
+	}{
+		{
+			name:    "valid proof",
+			proof:   func(t *testing.T) string { return testProof(t, key, nil) },
+			request: request,
+		},
+		{
+			name: "htu compared without query, default port and host case",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					claims["htu"] = "https://AUTH.example.com:443/token?x=1"
+				})
+			},
+			request: request,
+		},
+		{
+			name: "valid proof with ath",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					claims["ath"] = AccessTokenHash(testAccessToken)
+				})
+			},
+			request: withAccessToken,
+		},
+		{
+			name:    "empty proof",
+			proof:   func(t *testing.T) string { return "" },
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "wrong typ",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) { header["typ"] = "JWT" })
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "missing jwk",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) { delete(header, "jwk") })
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "private key in jwk",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					jwk := testJWK(key)
+					jwk["d"] = base64.RawURLEncoding.EncodeToString(key.D.Bytes())
+					header["jwk"] = jwk
+				})
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "signed by another key",
+			proof: func(t *testing.T) string {
+				return testProof(t, otherKey, func(header map[string]interface{}, claims jwt.MapClaims) { header["jwk"] = testJWK(key) })
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "symmetric algorithm",
+			proof: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": "proof-1", "htm": "POST", "htu": testURL, "iat": time.Now().Unix()})
+				token.Header["typ"] = proofType
+				token.Header["jwk"] = map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"}
+				signed, err := token.SignedString([]byte("secret"))
+				if err != nil {
+					t.Fatalf("sign proof: %v", err)
+				}
+				return signed
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "wrong method",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) { claims["htm"] = "GET" })
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "wrong url",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					claims["htu"] = "https://auth.example.com/revoke"
+				})
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "missing jti",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) { delete(claims, "jti") })
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "missing iat",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) { delete(claims, "iat") })
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "too old",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					claims["iat"] = time.Now().Add(-2 * time.Minute).Unix()
+				})
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name: "issued in the future",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					claims["iat"] = time.Now().Add(time.Minute).Unix()
+				})
+			},
+			request: request,
+			wantErr: true,
+		},
+		{
+			name:    "missing ath",
+			proof:   func(t *testing.T) string { return testProof(t, key, nil) },
+			request: withAccessToken,
+			wantErr: true,
+		},
+		{
+			name: "ath of another token",
+			proof: func(t *testing.T) string {
+				return testProof(t, key, func(header map[string]interface{}, claims jwt.MapClaims) {
+					claims["ath"] = AccessTokenHash("another-token")
+				})
+			},
+			request: withAccessToken,
+			wantErr: true,
+		},
+	}
+
+	wantJKT, err := jose.JWK{Kty: "EC", Crv: "P-256", X: testJWK(key)["x"].(string), Y: testJWK(key)["y"].(string)}.Thumbprint()
+	if err != nil {
+		t.Fatalf("thumbprint: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := Verify(tt.proof(t), tt.request)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidProof) {
+					t.Fatalf("expected ErrInvalidProof, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if proof.ID != "proof-1" || proof.JKT != wantJKT {
+				t.Errorf("proof = %+v, want jti proof-1 and jkt %s", proof, wantJKT)
+			}
+		})
+	}
+}
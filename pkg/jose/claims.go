@@ -0,0 +1,101 @@
+package jose
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// -----------------------------------------------------------------------------------------------
+// Комментарии для объяснения своих действий, а также лучшего понимания кода | t.me/fakelag
+// -----------------------------------------------------------------------------------------------
+
+// Значения заголовка typ служебных JWT. Они подписаны тем же ключом, что и access токены,
+// поэтому при проверке access токена их нужно отвергать.
+const (
+	TypeMFAToken  = "mfa+jwt"        // Промежуточный токен между паролем и вторым фактором
+	TypeDPoPNonce = "dpop-nonce+jwt" // Nonce DPoP, выданный сервером (RFC 9449, раздел 8)
+)
+
+// Claims - claims access токена, по этой структуре сервис их выпускает, а ресурсные сервисы проверяют
+type Claims struct {
+	UserID   uuid.UUID     `json:"user_id"`
+	TokenID  uuid.UUID     `json:"token_id"`
+	ClientIP string        `json:"client_ip,omitempty"`
+	AMR      []string      `json:"amr,omitempty"`       // Методы аутентификации (RFC 8176)
+	ACR      string        `json:"acr,omitempty"`       // Уровень аутентификации
+	ClientID string        `json:"client_id,omitempty"` // Клиент, которому выдан токен (RFC 9068)
+	AZP      string        `json:"azp,omitempty"`       // Authorized party, совпадает с client_id
+	Scope    string        `json:"scope,omitempty"`     // Выданные scope через пробел
+	Roles    []string      `json:"roles,omitempty"`     // Роли пользователя на момент выдачи
+	Cnf      *Confirmation `json:"cnf,omitempty"`       // Ключ, к которому привязан токен (RFC 7800)
+	jwt.RegisteredClaims
+}
+
+// Confirmation - claim cnf: чем клиент подтверждает, что токен предъявляет его владелец
+type Confirmation struct {
+	JKT string `json:"jkt,omitempty"`      // Отпечаток ключа DPoP (RFC 9449)
+	X5T string `json:"x5t#S256,omitempty"` // Отпечаток клиентского сертификата mTLS (RFC 8705)
+}
+
+// DPoPKey возвращает отпечаток ключа DPoP, к которому привязан токен, пусто - bearer токен
+func (c *Claims) DPoPKey() string {
+	if c.Cnf == nil {
+		return ""
+	}
+	return c.Cnf.JKT
+}
+
+// CertificateThumbprint возвращает отпечаток сертификата, к которому привязан токен, пусто - токен не привязан
+func (c *Claims) CertificateThumbprint() string {
+	if c.Cnf == nil {
+		return ""
+	}
+	return c.Cnf.X5T
+}
+
+// CertificateThumbprint считает x5t#S256 сертификата: base64url от SHA-256 его DER кодировки (RFC 8705, раздел 3.1)
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// MarshalJSON не пишет user_id в токены клиентов, у которых нет пользователя
+func (c Claims) MarshalJSON() ([]byte, error) {
+	// Локальный тип без методов, иначе json.Marshal снова вызовет MarshalJSON
+	type claims Claims
+	if c.UserID != uuid.Nil {
+		return json.Marshal(claims(c))
+	}
+
+	// Поле верхнего уровня перекрывает одноименное поле встроенной структуры
+	return json.Marshal(struct {
+		claims
+		UserID *uuid.UUID `json:"user_id,omitempty"`
+	}{claims: claims(c)})
+}
+
+// HasScope проверяет, выдан ли токену scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole проверяет, есть ли у пользователя роль
+func (c *Claims) HasRole(role string) bool {
+	for _, granted := range c.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}